@@ -1,8 +1,10 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"log/slog"
+	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
@@ -10,9 +12,10 @@ import (
 	"github.com/pete911/controller/pkg"
 	"github.com/pete911/controller/pkg/controller"
 	"github.com/pete911/controller/pkg/handler"
+	"github.com/pete911/controller/pkg/metrics"
 	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
-	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/record"
 )
 
 func main() {
@@ -20,54 +23,224 @@ func main() {
 	logger := pkg.NewLogger(flags.SlogLevel())
 	logger.Info(fmt.Sprintf("starting controller with flags: %+v", flags))
 
-	if err := run(logger); err != nil {
+	if err := run(logger, flags); err != nil {
 		logger.Error(err.Error())
 		os.Exit(1)
 	}
 }
 
-func run(logger *slog.Logger) error {
-	restConfig, err := rest.InClusterConfig()
+func run(logger *slog.Logger, flags pkg.Flags) error {
+	restConfig, err := pkg.NewRestConfig(flags.Kube)
 	if err != nil {
-		return fmt.Errorf("rest in cluster config: %v", err)
+		return fmt.Errorf("rest config: %v", err)
 	}
-	if err := startPodController(logger, restConfig); err != nil {
-		logger.Error(err.Error())
+	client, err := kubernetes.NewForConfig(restConfig)
+	if err != nil {
+		return fmt.Errorf("clientset for config: %v", err)
 	}
-	return nil
+	dynamicClient, err := dynamic.NewForConfig(restConfig)
+	if err != nil {
+		return fmt.Errorf("dynamic client for config: %v", err)
+	}
+
+	stopCh := getStopCh(logger)
+	admin := newAdmin(logger, flags.HttpAddr, flags.AdminAddr)
+	admin.run(stopCh)
+
+	manager := controller.NewManager(logger, controller.NewInformers(client, dynamicClient, 0), controller.NewRecorders(client))
+	for _, name := range flags.Controllers {
+		ctrl, err := newController(logger, name, client, dynamicClient, manager, flags)
+		if err != nil {
+			return err
+		}
+		if err := manager.Add(ctrl); err != nil {
+			return err
+		}
+		admin.handleAdmin(fmt.Sprintf("/admin/deadletters/%s", ctrl.Name()), controller.DeadLetterHandler(ctrl))
+	}
+	return runManager(logger, client, flags, manager, admin, stopCh)
 }
 
-func startPodController(logger *slog.Logger, cfg *rest.Config) error {
-	client, err := kubernetes.NewForConfig(cfg)
-	if err != nil {
-		return fmt.Errorf("clientset for config: %v", err)
+func newController(logger *slog.Logger, name string, client kubernetes.Interface, dynamicClient dynamic.Interface, manager *controller.Manager, flags pkg.Flags) (*controller.Controller, error) {
+	switch name {
+	case "pod":
+		return newPodController(logger, dynamicClient, manager, flags)
+	case "endpointsvc":
+		return newEndpointSvcController(logger, dynamicClient, manager, flags)
+	case "resource":
+		return newResourceController(logger, client, dynamicClient, manager, flags)
 	}
+	return nil, fmt.Errorf("unknown controller %s", name)
+}
 
-	h := handler.NewPod(logger, client)
-	ctrl, err := controller.NewController(logger, h)
+func newPodController(logger *slog.Logger, dynamicClient dynamic.Interface, manager *controller.Manager, flags pkg.Flags) (*controller.Controller, error) {
+	scope, err := controllerScope(flags.PodScope)
 	if err != nil {
-		return fmt.Errorf("new pod controller: %v", err)
+		return nil, fmt.Errorf("pod controller: %v", err)
 	}
-
-	ctrl.Run(getStopCh(logger))
-	return fmt.Errorf("pod controller stopped")
+	recorder := manager.Recorders().ForController("pod")
+	h := handler.NewPod(logger, manager.Informers(), scope, recorder)
+	opts := append(controllerOptions("pod", recorder, flags, flags.PodRetry),
+		controller.WithPredicates(h.Predicate()),
+		controller.WithIndexers(h.Indexers()),
+		controller.WithResource(handler.PodResource),
+	)
+	if flags.PodFinalizer != "" {
+		opts = append(opts, controller.WithFinalizer(flags.PodFinalizer, dynamicClient, handler.PodResource))
+	}
+	ctrl, err := controller.NewTypedController(logger, h, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("new pod controller: %v", err)
+	}
+	return ctrl, nil
 }
 
-// example of controller for custom objects (CRDs)
-func startEndpointSvcController(logger *slog.Logger, cfg *rest.Config) error {
-	client, err := dynamic.NewForConfig(cfg)
+// example of controller for custom objects (CRDs), requires ACK ec2 controller CRDs to be installed
+func newEndpointSvcController(logger *slog.Logger, dynamicClient dynamic.Interface, manager *controller.Manager, flags pkg.Flags) (*controller.Controller, error) {
+	scope, err := controllerScope(flags.EndpointSvcScope)
 	if err != nil {
-		return fmt.Errorf("clientset for config: %v", err)
+		return nil, fmt.Errorf("endpoint svc controller: %v", err)
+	}
+	recorder := manager.Recorders().ForController("endpointsvc")
+	conditions := controller.NewConditions(dynamicClient, handler.EndpointSvcResource)
+	h := handler.NewEndpointSvc(logger, manager.Informers(), scope, recorder, conditions)
+	// status changes are relevant, only periodic resyncs are filtered out
+	opts := append(controllerOptions("endpointsvc", recorder, flags, flags.EndpointSvcRetry),
+		controller.WithPredicates(controller.ResourceVersionChanged()),
+		controller.WithWatches(h.Watches()...),
+		controller.WithResource(handler.EndpointSvcResource),
+	)
+	if flags.EndpointSvcFinalizer != "" {
+		opts = append(opts, controller.WithFinalizer(flags.EndpointSvcFinalizer, dynamicClient, handler.EndpointSvcResource))
+	}
+	ctrl, err := controller.NewTypedController(logger, h, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("new endpoint svc controller: %v", err)
 	}
+	return ctrl, nil
+}
 
-	h := handler.NewEndpointSvc(logger, client)
-	ctrl, err := controller.NewController(logger, h)
+// example of generic controller, resource is set by flag and resolved by discovery, only handler body is needed
+func newResourceController(logger *slog.Logger, client kubernetes.Interface, dynamicClient dynamic.Interface, manager *controller.Manager, flags pkg.Flags) (*controller.Controller, error) {
+	scope, err := controllerScope(flags.ResourceScope)
+	if err != nil {
+		return nil, fmt.Errorf("resource controller: %v", err)
+	}
+	resource, err := controller.ResolveResource(controller.NewRESTMapper(client.Discovery()), flags.Resource)
+	if err != nil {
+		return nil, fmt.Errorf("resource controller: %v", err)
+	}
+	logger.Info(fmt.Sprintf("resource controller watching %s", resource))
+	opts := controllerOptions("resource", manager.Recorders().ForController("resource"), flags, flags.ResourceRetry)
+	if flags.ResourceFinalizer != "" {
+		opts = append(opts, controller.WithFinalizer(flags.ResourceFinalizer, dynamicClient, resource))
+	}
+	ctrl, err := controller.NewDynamicController(logger, manager.Informers(), resource, scope, handler.NewResource(logger), opts...)
 	if err != nil {
-		return fmt.Errorf("new endpoint svc controller: %v", err)
+		return nil, fmt.Errorf("new resource controller: %v", err)
 	}
+	return ctrl, nil
+}
 
-	ctrl.Run(getStopCh(logger))
-	return fmt.Errorf("endpoint svc controller stopped")
+func controllerOptions(name string, recorder record.EventRecorder, flags pkg.Flags, retry pkg.RetryFlags) []controller.Option {
+	opts := []controller.Option{
+		controller.WithName(name),
+		controller.WithWorkers(flags.Workers),
+		controller.WithStallTimeout(flags.StallTimeout),
+		controller.WithItemTimeout(flags.ItemTimeout),
+		controller.WithRetryPolicy(controller.RetryPolicy{
+			MaxRetries: retry.MaxRetries,
+			BaseDelay:  retry.BaseDelay,
+			MaxDelay:   retry.MaxDelay,
+			QPS:        retry.QPS,
+			Burst:      retry.Burst,
+		}),
+		controller.WithEventRecorder(recorder),
+	}
+	if flags.SuccessEvents {
+		opts = append(opts, controller.WithSuccessEvents())
+	}
+	return opts
+}
+
+func controllerScope(flags pkg.ScopeFlags) (controller.Scope, error) {
+	scope := controller.Scope{
+		Namespaces:    flags.Namespaces,
+		LabelSelector: flags.LabelSelector,
+		FieldSelector: flags.FieldSelector,
+	}
+	if err := scope.Validate(); err != nil {
+		return controller.Scope{}, fmt.Errorf("scope: %v", err)
+	}
+	return scope, nil
+}
+
+// admin is http server exposing metrics and health probes, admin endpoints (e.g. dead letters requeue) are exposed by
+// separate server, so they are not reachable on the metrics port
+type admin struct {
+	server      *pkg.Server
+	adminServer *pkg.Server
+	liveness    *pkg.Checks
+	readiness   *pkg.Checks
+}
+
+// newAdmin returns admin servers, admin endpoints are disabled if admin address is empty
+func newAdmin(logger *slog.Logger, addr, adminAddr string) admin {
+	a := admin{
+		server:    pkg.NewServer(logger, addr),
+		liveness:  pkg.NewChecks(),
+		readiness: pkg.NewChecks(),
+	}
+	a.server.Handle("/metrics", metrics.Handler())
+	a.server.Handle("/healthz", a.liveness)
+	a.server.Handle("/readyz", a.readiness)
+	if adminAddr != "" {
+		a.adminServer = pkg.NewServer(logger.With("server", "admin"), adminAddr)
+	}
+	return a
+}
+
+func (a admin) run(stopCh <-chan struct{}) {
+	a.server.Run(stopCh)
+	if a.adminServer != nil {
+		a.adminServer.Run(stopCh)
+	}
+}
+
+// handleAdmin registers admin endpoint, it is ignored if admin endpoints are disabled
+func (a admin) handleAdmin(pattern string, handler http.Handler) {
+	if a.adminServer != nil {
+		a.adminServer.Handle(pattern, handler)
+	}
+}
+
+// runManager blocks until stop signal is received, if leader election is enabled, controllers run only while
+// this instance holds the lease
+func runManager(logger *slog.Logger, client kubernetes.Interface, flags pkg.Flags, manager *controller.Manager, admin admin, stopCh <-chan struct{}) error {
+	admin.liveness.Add("workers", manager.Healthy)
+	admin.readiness.Add("cache", manager.Synced)
+	if !flags.LeaderElect {
+		manager.Run(stopCh)
+		return nil
+	}
+
+	elector, err := controller.NewLeaderElector(logger, client, controller.LeaderElectionConfig{
+		LeaseName:      flags.LeaderElection.LeaseName,
+		LeaseNamespace: flags.LeaderElection.LeaseNamespace,
+		LeaseDuration:  flags.LeaderElection.LeaseDuration,
+		RenewDeadline:  flags.LeaderElection.RenewDeadline,
+		RetryPeriod:    flags.LeaderElection.RetryPeriod,
+	})
+	if err != nil {
+		return fmt.Errorf("new leader elector: %v", err)
+	}
+	admin.readiness.Add("leader", func() error {
+		if !elector.IsLeader() {
+			return errors.New("not leader")
+		}
+		return nil
+	})
+	return elector.Run(stopCh, manager.Run)
 }
 
 func getStopCh(logger *slog.Logger) <-chan struct{} {
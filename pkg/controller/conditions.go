@@ -0,0 +1,164 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/util/retry"
+)
+
+// Condition is stored in status.conditions list of the object, conditions are identified by type
+type Condition struct {
+	Type    string
+	Status  metav1.ConditionStatus
+	Reason  string
+	Message string
+	// ObservedGeneration is generation of the object the condition was set for, object generation is used if not set
+	ObservedGeneration int64
+}
+
+// Conditions sets status conditions of objects of the resource through status subresource, objects are updated by
+// dynamic client, so both typed and unstructured objects are supported
+type Conditions struct {
+	client   dynamic.Interface
+	resource schema.GroupVersionResource
+}
+
+func NewConditions(client dynamic.Interface, resource schema.GroupVersionResource) *Conditions {
+	return &Conditions{client: client, resource: resource}
+}
+
+// Set sets conditions on the object status, other conditions are kept. Last transition time is changed only when
+// condition status changes. Object is not updated if none of the conditions changed, so obj should be the latest
+// object from informer cache. Update is retried with the latest object on conflict.
+func (c *Conditions) Set(ctx context.Context, obj runtime.Object, conditions ...Condition) error {
+	m, err := meta.Accessor(obj)
+	if err != nil {
+		return fmt.Errorf("object meta: %w", err)
+	}
+	current, err := toUnstructured(obj)
+	if err != nil {
+		return err
+	}
+	// conditions slice belongs to the caller, defaults are filled in on a copy
+	conditions = slices.Clone(conditions)
+	for i := range conditions {
+		if conditions[i].ObservedGeneration == 0 {
+			conditions[i].ObservedGeneration = m.GetGeneration()
+		}
+	}
+	if changed, err := setConditions(current, conditions); err != nil || !changed {
+		return err
+	}
+
+	resource := c.client.Resource(c.resource).Namespace(m.GetNamespace())
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		latest, err := resource.Get(ctx, m.GetName(), metav1.GetOptions{})
+		if err != nil {
+			return err
+		}
+		changed, err := setConditions(latest, conditions)
+		if err != nil || !changed {
+			return err
+		}
+		_, err = resource.UpdateStatus(ctx, latest, metav1.UpdateOptions{})
+		return err
+	})
+}
+
+// setConditions sets conditions in status.conditions of the object, returns true if any of them changed.
+// Observed generation is compared only if it is stored, so resources without observedGeneration in their condition
+// schema (e.g. ACK resources) are not updated on every call.
+func setConditions(obj *unstructured.Unstructured, conditions []Condition) (bool, error) {
+	existing, _, err := unstructured.NestedSlice(obj.Object, "status", "conditions")
+	if err != nil {
+		return false, fmt.Errorf("status conditions: %w", err)
+	}
+
+	var changed bool
+	now := time.Now().UTC().Format(time.RFC3339)
+	for _, condition := range conditions {
+		i := conditionIndex(existing, condition.Type)
+		if i < 0 {
+			existing = append(existing, conditionToMap(condition, now))
+			changed = true
+			continue
+		}
+		stored, ok := existing[i].(map[string]interface{})
+		if !ok {
+			return false, fmt.Errorf("status condition %s is %T type, expected map", condition.Type, existing[i])
+		}
+		if !conditionChanged(stored, condition) {
+			continue
+		}
+		lastTransitionTime := stored["lastTransitionTime"]
+		updated := conditionToMap(condition, now)
+		if stored["status"] == string(condition.Status) && lastTransitionTime != nil {
+			updated["lastTransitionTime"] = lastTransitionTime
+		}
+		existing[i] = updated
+		changed = true
+	}
+	if !changed {
+		return false, nil
+	}
+	if err := unstructured.SetNestedSlice(obj.Object, existing, "status", "conditions"); err != nil {
+		return false, fmt.Errorf("set status conditions: %w", err)
+	}
+	return true, nil
+}
+
+func conditionIndex(conditions []interface{}, conditionType string) int {
+	for i, c := range conditions {
+		if m, ok := c.(map[string]interface{}); ok && m["type"] == conditionType {
+			return i
+		}
+	}
+	return -1
+}
+
+func conditionChanged(stored map[string]interface{}, condition Condition) bool {
+	if stored["status"] != string(condition.Status) || stringValue(stored["reason"]) != condition.Reason || stringValue(stored["message"]) != condition.Message {
+		return true
+	}
+	if observedGeneration, ok := stored["observedGeneration"]; ok {
+		return observedGeneration != condition.ObservedGeneration
+	}
+	return false
+}
+
+func conditionToMap(condition Condition, lastTransitionTime string) map[string]interface{} {
+	return map[string]interface{}{
+		"type":               condition.Type,
+		"status":             string(condition.Status),
+		"reason":             condition.Reason,
+		"message":            condition.Message,
+		"observedGeneration": condition.ObservedGeneration,
+		"lastTransitionTime": lastTransitionTime,
+	}
+}
+
+func stringValue(v interface{}) string {
+	s, _ := v.(string)
+	return s
+}
+
+// toUnstructured returns copy of the object as unstructured
+func toUnstructured(obj runtime.Object) (*unstructured.Unstructured, error) {
+	if u, ok := obj.(*unstructured.Unstructured); ok {
+		return u.DeepCopy(), nil
+	}
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return nil, fmt.Errorf("convert %T to unstructured: %w", obj, err)
+	}
+	return &unstructured.Unstructured{Object: content}, nil
+}
@@ -0,0 +1,160 @@
+package controller
+
+import (
+	"context"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+)
+
+const testTransitionTime = "2020-01-01T00:00:00Z"
+
+// testConditionObject returns object with single Ready condition, observed generation is stored if it is not 0
+func testConditionObject(status, reason string, observedGeneration int64) *unstructured.Unstructured {
+	condition := map[string]interface{}{
+		"type":               "Ready",
+		"status":             status,
+		"reason":             reason,
+		"message":            "",
+		"lastTransitionTime": testTransitionTime,
+	}
+	if observedGeneration != 0 {
+		condition["observedGeneration"] = observedGeneration
+	}
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "example.com/v1",
+		"kind":       "Test",
+		"metadata":   map[string]interface{}{"name": "test", "namespace": "default", "generation": int64(2)},
+		"status":     map[string]interface{}{"conditions": []interface{}{condition}},
+	}}
+}
+
+func TestSetConditions(t *testing.T) {
+	tests := []struct {
+		name      string
+		obj       *unstructured.Unstructured
+		condition Condition
+		changed   bool
+		// transitionTimeKept is true if stored last transition time is expected to be kept
+		transitionTimeKept bool
+	}{
+		{
+			name:               "unchanged with stored observed generation",
+			obj:                testConditionObject("True", "Done", 2),
+			condition:          Condition{Type: "Ready", Status: metav1.ConditionTrue, Reason: "Done", ObservedGeneration: 2},
+			changed:            false,
+			transitionTimeKept: true,
+		},
+		{
+			name:               "unchanged without stored observed generation",
+			obj:                testConditionObject("True", "Done", 0),
+			condition:          Condition{Type: "Ready", Status: metav1.ConditionTrue, Reason: "Done", ObservedGeneration: 3},
+			changed:            false,
+			transitionTimeKept: true,
+		},
+		{
+			name:               "stored observed generation changed",
+			obj:                testConditionObject("True", "Done", 1),
+			condition:          Condition{Type: "Ready", Status: metav1.ConditionTrue, Reason: "Done", ObservedGeneration: 2},
+			changed:            true,
+			transitionTimeKept: true,
+		},
+		{
+			name:               "reason changed keeps transition time",
+			obj:                testConditionObject("False", "Pending", 2),
+			condition:          Condition{Type: "Ready", Status: metav1.ConditionFalse, Reason: "Waiting", ObservedGeneration: 2},
+			changed:            true,
+			transitionTimeKept: true,
+		},
+		{
+			name:               "status changed updates transition time",
+			obj:                testConditionObject("False", "Pending", 2),
+			condition:          Condition{Type: "Ready", Status: metav1.ConditionTrue, Reason: "Done", ObservedGeneration: 2},
+			changed:            true,
+			transitionTimeKept: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			changed, err := setConditions(tt.obj, []Condition{tt.condition})
+			if err != nil {
+				t.Fatalf("set conditions: %v", err)
+			}
+			if changed != tt.changed {
+				t.Errorf("expected changed %t, got %t", tt.changed, changed)
+			}
+			conditions, _, _ := unstructured.NestedSlice(tt.obj.Object, "status", "conditions")
+			if len(conditions) != 1 {
+				t.Fatalf("expected 1 condition, got %d", len(conditions))
+			}
+			condition := conditions[0].(map[string]interface{})
+			if kept := condition["lastTransitionTime"] == testTransitionTime; kept != tt.transitionTimeKept {
+				t.Errorf("expected transition time kept %t, got %v", tt.transitionTimeKept, condition["lastTransitionTime"])
+			}
+			if condition["status"] != string(tt.condition.Status) || condition["reason"] != tt.condition.Reason {
+				t.Errorf("expected status %s reason %s, got %v", tt.condition.Status, tt.condition.Reason, condition)
+			}
+		})
+	}
+}
+
+func TestSetConditionsAddsNewCondition(t *testing.T) {
+	obj := testConditionObject("True", "Done", 2)
+	changed, err := setConditions(obj, []Condition{{Type: "Synced", Status: metav1.ConditionTrue, Reason: "Synced"}})
+	if err != nil {
+		t.Fatalf("set conditions: %v", err)
+	}
+	if !changed {
+		t.Error("expected changed")
+	}
+	conditions, _, _ := unstructured.NestedSlice(obj.Object, "status", "conditions")
+	if len(conditions) != 2 || conditionIndex(conditions, "Ready") != 0 || conditionIndex(conditions, "Synced") != 1 {
+		t.Errorf("expected Ready and Synced conditions, got %v", conditions)
+	}
+}
+
+func TestConditionsSetUnchangedDoesNotCallAPI(t *testing.T) {
+	resource := schema.GroupVersionResource{Group: "example.com", Version: "v1", Resource: "tests"}
+	obj := testConditionObject("True", "Done", 0)
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{resource: "TestList"}, obj.DeepCopy())
+	conditions := NewConditions(client, resource)
+
+	if err := conditions.Set(context.Background(), obj, Condition{Type: "Ready", Status: metav1.ConditionTrue, Reason: "Done"}); err != nil {
+		t.Fatalf("set unchanged condition: %v", err)
+	}
+	if actions := client.Actions(); len(actions) != 0 {
+		t.Errorf("expected no api calls for unchanged condition, got %v", actions)
+	}
+
+	if err := conditions.Set(context.Background(), obj, Condition{Type: "Ready", Status: metav1.ConditionFalse, Reason: "Failed"}); err != nil {
+		t.Fatalf("set changed condition: %v", err)
+	}
+	var updates int
+	for _, action := range client.Actions() {
+		if action.GetVerb() == "update" && action.GetSubresource() == "status" {
+			updates++
+		}
+	}
+	if updates != 1 {
+		t.Errorf("expected 1 status update for changed condition, got %d", updates)
+	}
+}
+
+func TestConditionsSetDoesNotModifyArguments(t *testing.T) {
+	resource := schema.GroupVersionResource{Group: "example.com", Version: "v1", Resource: "tests"}
+	obj := testConditionObject("True", "Done", 0)
+	client := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{resource: "TestList"}, obj.DeepCopy())
+	conditions := NewConditions(client, resource)
+
+	ready := []Condition{{Type: "Ready", Status: metav1.ConditionFalse, Reason: "Failed"}}
+	if err := conditions.Set(context.Background(), obj, ready...); err != nil {
+		t.Fatalf("set condition: %v", err)
+	}
+	if ready[0].ObservedGeneration != 0 {
+		t.Errorf("expected caller condition observed generation 0, got %d", ready[0].ObservedGeneration)
+	}
+}
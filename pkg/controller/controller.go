@@ -1,30 +1,84 @@
 package controller
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log/slog"
+	"time"
 
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime/schema"
 	"k8s.io/client-go/tools/cache"
 	"k8s.io/client-go/util/workqueue"
 )
 
 type worker interface {
-	run(queue workqueue.TypedRateLimitingInterface[any], indexer cache.KeyGetter)
+	run(ctx context.Context, queue workqueue.TypedRateLimitingInterface[Key], indexer cache.KeyGetter)
+	// lastActivity returns time when worker last picked up an item from the queue, zero time if worker is not running
+	lastActivity() time.Time
 }
 
 type Controller struct {
-	logger   *slog.Logger
-	queue    workqueue.TypedRateLimitingInterface[any]
-	informer cache.SharedIndexInformer
-	worker   worker
+	name         string
+	resource     schema.GroupVersionResource
+	logger       *slog.Logger
+	queue        workqueue.TypedRateLimitingInterface[Key]
+	informer     cache.SharedIndexInformer
+	predicate    Predicate
+	worker       worker
+	stallTimeout time.Duration
+	deadLetters  *DeadLetterStore
+	deleted      *deletedObjects
+	finalizer    *finalizer
+	// watches are secondary informers, their events are mapped to keys of primary objects
+	watches []Watch
+	// events are coalesced informer events of keys in the queue, nil if handler does not implement EventHandler
+	events *pendingEvents
 }
 
-func NewController(logger *slog.Logger, handler Handler) (*Controller, error) {
+func NewController(logger *slog.Logger, handler Handler, opts ...Option) (*Controller, error) {
+	return NewContextController(logger, handlerAdapter{handler: handler}, opts...)
+}
+
+func NewContextController(logger *slog.Logger, handler ContextHandler, opts ...Option) (*Controller, error) {
+	o, err := newOptions(opts)
+	if err != nil {
+		return nil, fmt.Errorf("controller options: %w", err)
+	}
+
+	if _, ok := handler.(FinalizerHandler); o.finalizer != nil && !ok {
+		return nil, fmt.Errorf("controller %s with finalizer: handler does not implement FinalizerHandler", o.name)
+	}
+
+	logger = logger.With("controller", o.name)
+	deadLetters := NewDeadLetterStore()
+	deleted := newDeletedObjects()
+	var events *pendingEvents
+	if _, ok := handler.(EventHandler); ok {
+		events = newPendingEvents()
+	}
+	informer := handler.Informer()
+	if err := addIndexers(informer, o.indexers); err != nil {
+		return nil, fmt.Errorf("controller %s add indexers: %w", o.name, err)
+	}
 	controller := &Controller{
+		name:     o.name,
+		resource: o.resource,
 		logger:   logger.With("component", "controller"),
-		queue:    workqueue.NewTypedRateLimitingQueue(workqueue.DefaultTypedControllerRateLimiter[any]()),
-		informer: handler.Informer(),
-		worker:   newQueueWorker(logger, handler),
+		queue: workqueue.NewTypedRateLimitingQueueWithConfig(
+			o.retryPolicy.rateLimiter(),
+			workqueue.TypedRateLimitingQueueConfig[Key]{Name: o.name},
+		),
+		informer:     informer,
+		predicate:    And(o.predicates...),
+		worker:       newQueueWorker(logger, handler, o, deadLetters, deleted, events),
+		stallTimeout: o.stallTimeout,
+		deadLetters:  deadLetters,
+		deleted:      deleted,
+		finalizer:    o.finalizer,
+		watches:      o.watches,
+		events:       events,
 	}
 
 	if _, err := controller.informer.AddEventHandler(cache.ResourceEventHandlerFuncs{
@@ -34,6 +88,11 @@ func NewController(logger *slog.Logger, handler Handler) (*Controller, error) {
 	}); err != nil {
 		return nil, fmt.Errorf("add event handlers: %w", err)
 	}
+	for _, watch := range controller.watches {
+		if _, err := watch.Informer.AddEventHandler(controller.watchEventHandler(watch)); err != nil {
+			return nil, fmt.Errorf("add watch event handlers: %w", err)
+		}
+	}
 	return controller, nil
 }
 
@@ -43,8 +102,13 @@ func (c *Controller) addFunc(obj interface{}) {
 		c.logger.Error(fmt.Sprintf("handle add event: meta namespace key func: %v", err))
 		return
 	}
+	if !c.predicate.Add(obj) {
+		c.logger.Debug(fmt.Sprintf("add event %s filtered out", key))
+		return
+	}
 	c.logger.Debug(fmt.Sprintf("add event %s added to queue", key))
-	c.queue.Add(key)
+	c.addEvent(key, Event{Type: EventAdd, New: obj})
+	c.enqueue(key)
 }
 
 func (c *Controller) updateFunc(oldObj, newObj interface{}) {
@@ -53,8 +117,22 @@ func (c *Controller) updateFunc(oldObj, newObj interface{}) {
 		c.logger.Error(fmt.Sprintf("handle update event: meta namespace key func: %v", err))
 		return
 	}
+	// object was deleted and re-created while the informer was not watching (relist), it is handled as delete of the
+	// old incarnation and add of the new one
+	if oldUID, newUID := objectUID(oldObj), objectUID(newObj); oldUID != newUID {
+		c.logger.Debug(fmt.Sprintf("update event %s changed uid from %s to %s", key, oldUID, newUID))
+		c.deleteFunc(oldObj)
+		c.addFunc(newObj)
+		return
+	}
+	// objects waiting for finalization are not filtered, otherwise finalizer would never be removed
+	if !c.finalizerPending(newObj) && !c.predicate.Update(oldObj, newObj) {
+		c.logger.Debug(fmt.Sprintf("update event %s filtered out", key))
+		return
+	}
 	c.logger.Debug(fmt.Sprintf("update event %s added to queue", key))
-	c.queue.Add(key)
+	c.addEvent(key, Event{Type: updateEventType(oldObj, newObj), Old: oldObj, New: newObj})
+	c.enqueue(key)
 }
 
 func (c *Controller) deleteFunc(obj interface{}) {
@@ -63,26 +141,195 @@ func (c *Controller) deleteFunc(obj interface{}) {
 		c.logger.Error(fmt.Sprintf("handle delete event: meta namespace key func: %v", err))
 		return
 	}
+	if !c.predicate.Delete(obj) {
+		c.logger.Debug(fmt.Sprintf("delete event %s filtered out", key))
+		return
+	}
 	c.logger.Debug(fmt.Sprintf("delete event %s added to queue", key))
-	c.queue.Add(key)
+	c.deleted.set(key, obj)
+	c.addEvent(key, Event{Type: EventDelete, Old: c.deleted.get(key)})
+	c.enqueue(key)
+}
+
+// enqueue adds namespace/name key to the queue
+func (c *Controller) enqueue(key string) {
+	item, err := newKey(c.resource, key)
+	if err != nil {
+		c.logger.Error(fmt.Sprintf("add %s to queue: %v", key, err))
+		return
+	}
+	c.queue.Add(item)
+}
+
+// addEvent coalesces event with pending event of the key, if handler implements EventHandler
+func (c *Controller) addEvent(key string, event Event) {
+	if c.events != nil {
+		c.events.add(key, event)
+	}
+}
+
+// updateEventType returns resync type if the object did not change (informer resync), update otherwise
+func updateEventType(oldObj, newObj interface{}) EventType {
+	oldMeta, oldErr := meta.Accessor(oldObj)
+	newMeta, newErr := meta.Accessor(newObj)
+	if oldErr == nil && newErr == nil && oldMeta.GetResourceVersion() == newMeta.GetResourceVersion() {
+		return EventResync
+	}
+	return EventUpdate
+}
+
+// watchEventHandler maps secondary informer events to primary keys, both old and new object are mapped on update, so
+// primary object that no longer relates to the secondary object is reconciled too
+func (c *Controller) watchEventHandler(watch Watch) cache.ResourceEventHandlerFuncs {
+	predicate := watch.Predicate
+	if predicate == nil {
+		predicate = PredicateFuncs{}
+	}
+	return cache.ResourceEventHandlerFuncs{
+		AddFunc: func(obj interface{}) {
+			if predicate.Add(obj) {
+				c.enqueueMapped("add", watch.Map(obj))
+			}
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) {
+			if predicate.Update(oldObj, newObj) {
+				c.enqueueMapped("update", append(watch.Map(oldObj), watch.Map(newObj)...))
+			}
+		},
+		DeleteFunc: func(obj interface{}) {
+			if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+				obj = tombstone.Obj
+			}
+			if predicate.Delete(obj) {
+				c.enqueueMapped("delete", watch.Map(obj))
+			}
+		},
+	}
+}
+
+func (c *Controller) enqueueMapped(event string, keys []string) {
+	for _, key := range keys {
+		c.logger.Debug(fmt.Sprintf("watch %s event mapped to %s, added to queue", event, key))
+		// queue de-duplicates keys that are mapped from both old and new object
+		c.enqueue(key)
+	}
+}
+
+// informers returns primary informer and informers of watches
+func (c *Controller) informers() []cache.SharedIndexInformer {
+	informers := []cache.SharedIndexInformer{c.informer}
+	for _, watch := range c.watches {
+		informers = append(informers, watch.Informer)
+	}
+	return informers
+}
+
+// hasSynced returns true if primary informer and informers of watches synced
+func (c *Controller) hasSynced() bool {
+	for _, informer := range c.informers() {
+		if !informer.HasSynced() {
+			return false
+		}
+	}
+	return true
+}
+
+func (c *Controller) finalizerPending(obj interface{}) bool {
+	if c.finalizer == nil {
+		return false
+	}
+	m, err := meta.Accessor(obj)
+	return err == nil && c.finalizer.pending(m)
+}
+
+func (c *Controller) Name() string {
+	return c.name
+}
+
+// Synced returns error if informer caches have not synced yet
+func (c *Controller) Synced() error {
+	if !c.hasSynced() {
+		return errors.New("informer cache not synced")
+	}
+	return nil
+}
+
+// Healthy returns error if workers have not picked up any item from non-empty queue for longer than stall timeout
+func (c *Controller) Healthy() error {
+	lastActivity := c.worker.lastActivity()
+	if lastActivity.IsZero() || c.queue.Len() == 0 {
+		return nil
+	}
+	if since := time.Since(lastActivity); since > c.stallTimeout {
+		return fmt.Errorf("workers stalled, no item picked up from queue with %d items for %s", c.queue.Len(), since.Round(time.Second))
+	}
+	return nil
+}
+
+// DeadLetters returns items that exhausted all their retries
+func (c *Controller) DeadLetters() []DeadLetter {
+	return c.deadLetters.List()
 }
 
+// RequeueDeadLetter removes item from dead letters and adds it back to the queue
+func (c *Controller) RequeueDeadLetter(key string) error {
+	if _, ok := c.deadLetters.take(key); !ok {
+		return fmt.Errorf("dead letter %s not found", key)
+	}
+	c.logger.Info(fmt.Sprintf("dead letter %s added to queue", key))
+	c.enqueue(key)
+	return nil
+}
+
+// RequeueDeadLetters adds all dead letters back to the queue and returns number of requeued items
+func (c *Controller) RequeueDeadLetters() int {
+	keys := c.deadLetters.takeAll()
+	for _, key := range keys {
+		c.enqueue(key)
+	}
+	c.logger.Info(fmt.Sprintf("%d dead letters added to queue", len(keys)))
+	return len(keys)
+}
+
+// Run starts the informers and runs workers until stop channel is closed
 func (c *Controller) Run(stopCh <-chan struct{}) {
 	c.logger.Info("starting controller")
+	for _, informer := range c.informers() {
+		go func(informer cache.SharedIndexInformer) {
+			informer.Run(stopCh)
+			c.logger.Info("informer stopped")
+		}(informer)
+	}
+	c.run(stopCh)
+}
+
+// run waits for informer caches to sync and runs workers until stop channel is closed, informers have to be started
+// by the caller
+func (c *Controller) run(stopCh <-chan struct{}) {
 	go func() {
-		c.informer.Run(stopCh)
-		c.logger.Info("informer stopped")
+		<-stopCh
 		c.queue.ShutDown()
 		c.logger.Info("queue shut down")
 	}()
 
 	c.logger.Info("waiting for cache sync")
-	if !cache.WaitForCacheSync(stopCh, c.informer.HasSynced) {
+	if !cache.WaitForCacheSync(stopCh, c.hasSynced) {
 		c.logger.Error("failed to sync")
 		return
 	}
 	c.logger.Info("cache synced")
-	c.logger.Info("starting controller worker")
-	c.worker.run(c.queue, c.informer.GetIndexer())
-	c.logger.Info("controller worker stopped")
+	// context passed to handlers is cancelled on shutdown, so long-running handler work can be interrupted
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() {
+		select {
+		case <-stopCh:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+
+	c.logger.Info("starting controller workers")
+	c.worker.run(ctx, c.queue, c.informer.GetIndexer())
+	c.logger.Info("controller workers stopped")
 }
@@ -0,0 +1,50 @@
+package controller
+
+import (
+	"log/slog"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestControllerUpdateFuncUIDChanged(t *testing.T) {
+	filterUpdates := PredicateFuncs{UpdateFunc: func(oldObj, newObj interface{}) bool { return false }}
+
+	tests := []struct {
+		name       string
+		newUID     types.UID
+		predicates []Predicate
+		deleted    bool
+		queued     bool
+	}{
+		{name: "uid changed", newUID: "uid-b", deleted: true, queued: true},
+		{name: "uid changed is not filtered as update", newUID: "uid-b", predicates: []Predicate{filterUpdates}, deleted: true, queued: true},
+		{name: "same uid", newUID: "uid-a", queued: true},
+		{name: "same uid filtered", newUID: "uid-a", predicates: []Predicate{filterUpdates}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := testHandler{informer: &fakeInformer{}}
+			c, err := NewContextController(slog.New(slog.DiscardHandler), handler, WithName(t.Name()), WithPredicates(tt.predicates...))
+			if err != nil {
+				t.Fatalf("new controller: %v", err)
+			}
+			t.Cleanup(c.queue.ShutDown)
+
+			oldPod, newPod := testPodUID("pod", "uid-a"), testPodUID("pod", tt.newUID)
+			oldPod.ResourceVersion, newPod.ResourceVersion = "1", "2"
+			c.updateFunc(oldPod, newPod)
+
+			obj := c.deleted.get("a/pod")
+			if (obj != nil) != tt.deleted {
+				t.Fatalf("expected deleted object stored %t, got %v", tt.deleted, obj)
+			}
+			if obj != nil && objectUID(obj) != "uid-a" {
+				t.Errorf("expected deleted object uid uid-a, got %s", objectUID(obj))
+			}
+			if queued := c.queue.Len() == 1; queued != tt.queued {
+				t.Errorf("expected key queued %t, got queue length %d", tt.queued, c.queue.Len())
+			}
+		})
+	}
+}
@@ -0,0 +1,133 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+// DeadLetter is an item that failed and exhausted all its retries
+type DeadLetter struct {
+	Key          string    `json:"key"`
+	Error        string    `json:"error"`
+	Attempts     int       `json:"attempts"`
+	FirstFailure time.Time `json:"firstFailure"`
+	LastFailure  time.Time `json:"lastFailure"`
+}
+
+// DeadLetterStore keeps items that exhausted their retries, until they are requeued or successfully processed
+type DeadLetterStore struct {
+	mu sync.RWMutex
+	// firstFailures keeps time of the first failure of items that are still being retried
+	firstFailures map[string]time.Time
+	items         map[string]DeadLetter
+}
+
+func NewDeadLetterStore() *DeadLetterStore {
+	return &DeadLetterStore{
+		firstFailures: make(map[string]time.Time),
+		items:         make(map[string]DeadLetter),
+	}
+}
+
+// failed records failure of an item that is going to be retried
+func (s *DeadLetterStore) failed(key string, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.firstFailures[key]; !ok {
+		s.firstFailures[key] = now
+	}
+}
+
+// dead records item that exhausted its retries
+func (s *DeadLetterStore) dead(key string, err error, attempts int, now time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	firstFailure, ok := s.firstFailures[key]
+	if !ok {
+		firstFailure = now
+	}
+	delete(s.firstFailures, key)
+	s.items[key] = DeadLetter{
+		Key:          key,
+		Error:        err.Error(),
+		Attempts:     attempts,
+		FirstFailure: firstFailure,
+		LastFailure:  now,
+	}
+}
+
+// succeeded removes item from the store, if it has been processed without error
+func (s *DeadLetterStore) succeeded(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.firstFailures, key)
+	delete(s.items, key)
+}
+
+// take removes item from the store and returns it
+func (s *DeadLetterStore) take(key string) (DeadLetter, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	item, ok := s.items[key]
+	delete(s.items, key)
+	return item, ok
+}
+
+// takeAll removes all items from the store and returns their keys
+func (s *DeadLetterStore) takeAll() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var keys []string
+	for key := range s.items {
+		keys = append(keys, key)
+	}
+	clear(s.items)
+	return keys
+}
+
+// List returns all dead items sorted by key
+func (s *DeadLetterStore) List() []DeadLetter {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	out := make([]DeadLetter, 0, len(s.items))
+	for _, item := range s.items {
+		out = append(out, item)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Key < out[j].Key })
+	return out
+}
+
+// DeadLetterHandler returns http handler for controller dead letters. GET lists dead items, POST with key query
+// parameter re-enqueues single item and POST without key re-enqueues all dead items.
+func DeadLetterHandler(c *Controller) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			writeJSON(w, http.StatusOK, c.DeadLetters())
+		case http.MethodPost:
+			key := r.URL.Query().Get("key")
+			if key == "" {
+				writeJSON(w, http.StatusOK, map[string]int{"requeued": c.RequeueDeadLetters()})
+				return
+			}
+			if err := c.RequeueDeadLetter(key); err != nil {
+				writeJSON(w, http.StatusNotFound, map[string]string{"error": err.Error()})
+				return
+			}
+			writeJSON(w, http.StatusOK, map[string]int{"requeued": 1})
+		default:
+			w.Header().Set("Allow", "GET, POST")
+			writeJSON(w, http.StatusMethodNotAllowed, map[string]string{"error": fmt.Sprintf("method %s not allowed", r.Method)})
+		}
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
@@ -0,0 +1,40 @@
+package controller
+
+import (
+	"sync"
+
+	"k8s.io/client-go/tools/cache"
+)
+
+// deletedObjects keeps last known state of deleted objects, until their deletion is processed by the handler
+type deletedObjects struct {
+	mu      sync.Mutex
+	objects map[string]interface{}
+}
+
+func newDeletedObjects() *deletedObjects {
+	return &deletedObjects{objects: make(map[string]interface{})}
+}
+
+// set stores deleted object, tombstone is unwrapped to the last object state known to the informer
+func (d *deletedObjects) set(key string, obj interface{}) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.objects[key] = obj
+}
+
+// get returns last known state of deleted object, nil if it is not known
+func (d *deletedObjects) get(key string) interface{} {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.objects[key]
+}
+
+func (d *deletedObjects) remove(key string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	delete(d.objects, key)
+}
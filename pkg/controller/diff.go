@@ -0,0 +1,83 @@
+package controller
+
+import (
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// ignoredDiffPaths change on every update and are not reported by Diff
+var ignoredDiffPaths = map[string]struct{}{
+	"metadata.resourceVersion": {},
+	"metadata.managedFields":   {},
+}
+
+// Diff returns sorted paths of fields that differ between old and new object, e.g. metadata.labels.app or
+// spec.containers[0].image. Lists of different length are reported as whole, resource version and managed fields
+// are ignored.
+func Diff(oldObj, newObj interface{}) ([]string, error) {
+	oldContent, err := diffContent(oldObj)
+	if err != nil {
+		return nil, err
+	}
+	newContent, err := diffContent(newObj)
+	if err != nil {
+		return nil, err
+	}
+	var paths []string
+	diffValues("", oldContent, newContent, &paths)
+	slices.Sort(paths)
+	return paths, nil
+}
+
+func diffContent(obj interface{}) (map[string]interface{}, error) {
+	runtimeObj, ok := obj.(runtime.Object)
+	if !ok {
+		return nil, fmt.Errorf("object is %T type, expected runtime object", obj)
+	}
+	u, err := toUnstructured(runtimeObj)
+	if err != nil {
+		return nil, err
+	}
+	return u.Object, nil
+}
+
+func diffValues(path string, oldValue, newValue interface{}, paths *[]string) {
+	if _, ok := ignoredDiffPaths[path]; ok {
+		return
+	}
+	oldMap, oldIsMap := oldValue.(map[string]interface{})
+	newMap, newIsMap := newValue.(map[string]interface{})
+	if oldIsMap && newIsMap {
+		keys := slices.Collect(maps.Keys(oldMap))
+		for key := range newMap {
+			if _, ok := oldMap[key]; !ok {
+				keys = append(keys, key)
+			}
+		}
+		for _, key := range keys {
+			childPath := key
+			if path != "" {
+				childPath = path + "." + key
+			}
+			diffValues(childPath, oldMap[key], newMap[key], paths)
+		}
+		return
+	}
+
+	oldSlice, oldIsSlice := oldValue.([]interface{})
+	newSlice, newIsSlice := newValue.([]interface{})
+	if oldIsSlice && newIsSlice && len(oldSlice) == len(newSlice) {
+		for i := range oldSlice {
+			diffValues(fmt.Sprintf("%s[%d]", path, i), oldSlice[i], newSlice[i], paths)
+		}
+		return
+	}
+
+	if !reflect.DeepEqual(oldValue, newValue) {
+		*paths = append(*paths, path)
+	}
+}
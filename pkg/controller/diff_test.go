@@ -0,0 +1,106 @@
+package controller
+
+import (
+	"slices"
+	"testing"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func testUnstructured(metadata, spec map[string]interface{}) *unstructured.Unstructured {
+	return &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "Pod",
+		"metadata":   metadata,
+		"spec":       spec,
+	}}
+}
+
+func TestDiff(t *testing.T) {
+	containers := func(images ...string) []interface{} {
+		var out []interface{}
+		for _, image := range images {
+			out = append(out, map[string]interface{}{"name": "app", "image": image})
+		}
+		return out
+	}
+
+	tests := []struct {
+		name     string
+		old      *unstructured.Unstructured
+		new      *unstructured.Unstructured
+		expected []string
+	}{
+		{
+			name:     "no change",
+			old:      testUnstructured(map[string]interface{}{"name": "a"}, map[string]interface{}{"nodeName": "n"}),
+			new:      testUnstructured(map[string]interface{}{"name": "a"}, map[string]interface{}{"nodeName": "n"}),
+			expected: nil,
+		},
+		{
+			name:     "nested map value changed",
+			old:      testUnstructured(map[string]interface{}{"name": "a", "labels": map[string]interface{}{"app": "x", "tier": "web"}}, nil),
+			new:      testUnstructured(map[string]interface{}{"name": "a", "labels": map[string]interface{}{"app": "y", "tier": "web"}}, nil),
+			expected: []string{"metadata.labels.app"},
+		},
+		{
+			name:     "nested map keys added and removed",
+			old:      testUnstructured(map[string]interface{}{"name": "a", "labels": map[string]interface{}{"app": "x"}}, nil),
+			new:      testUnstructured(map[string]interface{}{"name": "a", "labels": map[string]interface{}{"tier": "web"}}, nil),
+			expected: []string{"metadata.labels.app", "metadata.labels.tier"},
+		},
+		{
+			name:     "map added",
+			old:      testUnstructured(map[string]interface{}{"name": "a"}, nil),
+			new:      testUnstructured(map[string]interface{}{"name": "a", "labels": map[string]interface{}{"app": "x"}}, nil),
+			expected: []string{"metadata.labels"},
+		},
+		{
+			name:     "list element changed",
+			old:      testUnstructured(map[string]interface{}{"name": "a"}, map[string]interface{}{"containers": containers("app:1", "sidecar:1")}),
+			new:      testUnstructured(map[string]interface{}{"name": "a"}, map[string]interface{}{"containers": containers("app:1", "sidecar:2")}),
+			expected: []string{"spec.containers[1].image"},
+		},
+		{
+			name:     "list of different length is reported as whole",
+			old:      testUnstructured(map[string]interface{}{"name": "a"}, map[string]interface{}{"containers": containers("app:1")}),
+			new:      testUnstructured(map[string]interface{}{"name": "a"}, map[string]interface{}{"containers": containers("app:2", "sidecar:1")}),
+			expected: []string{"spec.containers"},
+		},
+		{
+			name: "resource version and managed fields are ignored",
+			old: testUnstructured(map[string]interface{}{"name": "a", "resourceVersion": "1",
+				"managedFields": []interface{}{map[string]interface{}{"manager": "a"}}}, nil),
+			new: testUnstructured(map[string]interface{}{"name": "a", "resourceVersion": "2",
+				"managedFields": []interface{}{map[string]interface{}{"manager": "b"}}, "generation": int64(2)}, nil),
+			expected: []string{"metadata.generation"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			paths, err := Diff(tt.old, tt.new)
+			if err != nil {
+				t.Fatalf("diff: %v", err)
+			}
+			if !slices.Equal(paths, tt.expected) {
+				t.Errorf("expected %v, got %v", tt.expected, paths)
+			}
+		})
+	}
+}
+
+func TestDiffTypedObjects(t *testing.T) {
+	paths, err := Diff(testPod("a", "pod", "node-1"), testPod("a", "pod", "node-2"))
+	if err != nil {
+		t.Fatalf("diff: %v", err)
+	}
+	if !slices.Equal(paths, []string{"spec.nodeName"}) {
+		t.Errorf("expected [spec.nodeName], got %v", paths)
+	}
+}
+
+func TestDiffNotRuntimeObject(t *testing.T) {
+	if _, err := Diff("a", "b"); err == nil {
+		t.Error("expected error for objects that are not runtime objects")
+	}
+}
@@ -0,0 +1,41 @@
+package controller
+
+import (
+	"context"
+	"log/slog"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/cache"
+)
+
+// DynamicHandler is a handler of objects of any resource, objects are passed as unstructured and the informer is
+// provided by NewDynamicController. Handler can implement TypedFinalizerHandler[*unstructured.Unstructured] as well.
+type DynamicHandler interface {
+	AddOrUpdate(ctx context.Context, key string, obj *unstructured.Unstructured) (Result, error)
+	Delete(ctx context.Context, key string, obj *unstructured.Unstructured) (Result, error)
+}
+
+// NewDynamicController returns controller of resource objects in scope, so watching a new resource (e.g. CRD) needs
+// only the handler body. Resource can be resolved by ResolveResource.
+func NewDynamicController(logger *slog.Logger, informers *Informers, resource schema.GroupVersionResource, scope Scope, handler DynamicHandler, opts ...Option) (*Controller, error) {
+	h := dynamicHandler{DynamicHandler: handler, informer: informers.ForResource(resource, scope)}
+	opts = append([]Option{WithResource(resource)}, opts...)
+	if finalizerHandler, ok := handler.(TypedFinalizerHandler[*unstructured.Unstructured]); ok {
+		return NewTypedController[*unstructured.Unstructured](logger, struct {
+			dynamicHandler
+			TypedFinalizerHandler[*unstructured.Unstructured]
+		}{h, finalizerHandler}, opts...)
+	}
+	return NewTypedController[*unstructured.Unstructured](logger, h, opts...)
+}
+
+// dynamicHandler adds informer to DynamicHandler, so it implements TypedHandler
+type dynamicHandler struct {
+	DynamicHandler
+	informer cache.SharedIndexInformer
+}
+
+func (h dynamicHandler) Informer() cache.SharedIndexInformer {
+	return h.informer
+}
@@ -0,0 +1,79 @@
+package controller
+
+import (
+	"fmt"
+	"time"
+)
+
+// error classes used in metrics
+const (
+	errorClassPermanent   = "permanent"
+	errorClassTransient   = "transient"
+	errorClassRateLimited = "rate_limited"
+)
+
+// PermanentError is returned by handler when retrying would not help, item is moved to dead letters without retries
+type PermanentError struct {
+	Err error
+}
+
+func (e *PermanentError) Error() string {
+	return fmt.Sprintf("permanent error: %v", e.Err)
+}
+
+func (e *PermanentError) Unwrap() error {
+	return e.Err
+}
+
+// Permanent wraps error as PermanentError, nil error is returned as nil
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &PermanentError{Err: err}
+}
+
+// TransientError is retried with backoff according to retry policy, handler errors that are not wrapped are
+// transient too
+type TransientError struct {
+	Err error
+}
+
+func (e *TransientError) Error() string {
+	return fmt.Sprintf("transient error: %v", e.Err)
+}
+
+func (e *TransientError) Unwrap() error {
+	return e.Err
+}
+
+// Transient wraps error as TransientError, nil error is returned as nil
+func Transient(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &TransientError{Err: err}
+}
+
+// RateLimitedError is returned by handler when downstream service rate limited the request, item is retried after
+// the duration and the retry does not count against retry policy. Error with non-positive duration is transient.
+type RateLimitedError struct {
+	Err   error
+	After time.Duration
+}
+
+func (e *RateLimitedError) Error() string {
+	return fmt.Sprintf("rate limited, retry after %s: %v", e.After, e.Err)
+}
+
+func (e *RateLimitedError) Unwrap() error {
+	return e.Err
+}
+
+// RateLimited wraps error as RateLimitedError, nil error is returned as nil
+func RateLimited(err error, after time.Duration) error {
+	if err == nil {
+		return nil
+	}
+	return &RateLimitedError{Err: err, After: after}
+}
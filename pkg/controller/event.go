@@ -0,0 +1,131 @@
+package controller
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+
+	"k8s.io/client-go/tools/cache"
+)
+
+type EventType string
+
+const (
+	EventAdd    EventType = "add"
+	EventUpdate EventType = "update"
+	// EventResync is periodic resync, or item that was added to the queue without informer event, e.g. requeued item,
+	// requeued dead letter or key mapped from watched object
+	EventResync EventType = "resync"
+	EventDelete EventType = "delete"
+)
+
+// Event is informer event, events of the same key that are merged by the queue are coalesced into single event. Old
+// is the object before the first of the events and New is the latest object. Add followed by update is add, any event
+// followed by delete is delete and delete followed by add (object was re-created) is add.
+type Event struct {
+	Type EventType
+	// Old is nil for add event, for delete event it is the last known object state, or nil if it is not known
+	Old interface{}
+	// New is nil for delete event
+	New interface{}
+}
+
+// Diff returns paths of fields that differ between old and new object, empty for add and delete events
+func (e Event) Diff() ([]string, error) {
+	if e.Old == nil || e.New == nil {
+		return nil, nil
+	}
+	return Diff(e.Old, e.New)
+}
+
+// coalesce merges next event into event that happened before it
+func coalesce(event, next Event) Event {
+	switch {
+	case next.Type == EventDelete:
+		return Event{Type: EventDelete, Old: next.Old}
+	case event.Type == EventAdd, event.Type == EventDelete:
+		return Event{Type: EventAdd, New: next.New}
+	case event.Type == EventResync && next.Type == EventResync:
+		return Event{Type: EventResync, Old: event.Old, New: next.New}
+	}
+	return Event{Type: EventUpdate, Old: event.Old, New: next.New}
+}
+
+// EventHandler is a richer alternative to ContextHandler, handler receives event type, old and new object
+type EventHandler interface {
+	HandleEvent(ctx context.Context, key string, event Event) (Result, error)
+	Informer() cache.SharedIndexInformer
+}
+
+// NewEventController returns controller calling event handler, handler can implement FinalizerHandler as well
+func NewEventController(logger *slog.Logger, handler EventHandler, opts ...Option) (*Controller, error) {
+	adapter := eventHandlerAdapter{handler: handler}
+	if finalizerHandler, ok := handler.(FinalizerHandler); ok {
+		return NewContextController(logger, struct {
+			eventHandlerAdapter
+			FinalizerHandler
+		}{adapter, finalizerHandler}, opts...)
+	}
+	return NewContextController(logger, adapter, opts...)
+}
+
+// eventHandlerAdapter adapts EventHandler to ContextHandler, worker calls HandleEvent of handlers that implement
+// EventHandler, add/update and delete calls are converted to resync and delete events
+type eventHandlerAdapter struct {
+	handler EventHandler
+}
+
+func (h eventHandlerAdapter) HandleEvent(ctx context.Context, key string, event Event) (Result, error) {
+	return h.handler.HandleEvent(ctx, key, event)
+}
+
+func (h eventHandlerAdapter) AddOrUpdate(ctx context.Context, key string, value interface{}) (Result, error) {
+	return h.handler.HandleEvent(ctx, key, Event{Type: EventResync, Old: value, New: value})
+}
+
+func (h eventHandlerAdapter) Delete(ctx context.Context, key string, value interface{}) (Result, error) {
+	return h.handler.HandleEvent(ctx, key, Event{Type: EventDelete, Old: value})
+}
+
+func (h eventHandlerAdapter) Informer() cache.SharedIndexInformer {
+	return h.handler.Informer()
+}
+
+// pendingEvents keeps coalesced events of keys in the queue, until they are processed by the worker
+type pendingEvents struct {
+	mu     sync.Mutex
+	events map[string]Event
+}
+
+func newPendingEvents() *pendingEvents {
+	return &pendingEvents{events: make(map[string]Event)}
+}
+
+// add coalesces event with pending event of the key
+func (p *pendingEvents) add(key string, event Event) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if pending, ok := p.events[key]; ok {
+		event = coalesce(pending, event)
+	}
+	p.events[key] = event
+}
+
+// take removes and returns pending event of the key
+func (p *pendingEvents) take(key string) (Event, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	event, ok := p.events[key]
+	delete(p.events, key)
+	return event, ok
+}
+
+// restore returns event that failed to be processed, events added in the meantime are coalesced with it
+func (p *pendingEvents) restore(key string, event Event) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if pending, ok := p.events[key]; ok {
+		event = coalesce(event, pending)
+	}
+	p.events[key] = event
+}
@@ -0,0 +1,244 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+func TestCoalesce(t *testing.T) {
+	v1Pod, v2Pod, v3Pod := testPod("a", "v1", ""), testPod("a", "v2", ""), testPod("a", "v3", "")
+
+	tests := []struct {
+		name     string
+		event    Event
+		next     Event
+		expected Event
+	}{
+		{
+			name:     "add followed by update is add",
+			event:    Event{Type: EventAdd, New: v1Pod},
+			next:     Event{Type: EventUpdate, Old: v1Pod, New: v2Pod},
+			expected: Event{Type: EventAdd, New: v2Pod},
+		},
+		{
+			name:     "add followed by delete is delete",
+			event:    Event{Type: EventAdd, New: v1Pod},
+			next:     Event{Type: EventDelete, Old: v1Pod},
+			expected: Event{Type: EventDelete, Old: v1Pod},
+		},
+		{
+			name:     "update followed by delete is delete of the last state",
+			event:    Event{Type: EventUpdate, Old: v1Pod, New: v2Pod},
+			next:     Event{Type: EventDelete, Old: v2Pod},
+			expected: Event{Type: EventDelete, Old: v2Pod},
+		},
+		{
+			name:     "delete followed by add is add",
+			event:    Event{Type: EventDelete, Old: v1Pod},
+			next:     Event{Type: EventAdd, New: v2Pod},
+			expected: Event{Type: EventAdd, New: v2Pod},
+		},
+		{
+			name:     "update followed by update keeps the first old object",
+			event:    Event{Type: EventUpdate, Old: v1Pod, New: v2Pod},
+			next:     Event{Type: EventUpdate, Old: v2Pod, New: v3Pod},
+			expected: Event{Type: EventUpdate, Old: v1Pod, New: v3Pod},
+		},
+		{
+			name:     "resync followed by resync is resync",
+			event:    Event{Type: EventResync, Old: v1Pod, New: v1Pod},
+			next:     Event{Type: EventResync, Old: v1Pod, New: v1Pod},
+			expected: Event{Type: EventResync, Old: v1Pod, New: v1Pod},
+		},
+		{
+			name:     "resync followed by update is update",
+			event:    Event{Type: EventResync, Old: v1Pod, New: v1Pod},
+			next:     Event{Type: EventUpdate, Old: v1Pod, New: v2Pod},
+			expected: Event{Type: EventUpdate, Old: v1Pod, New: v2Pod},
+		},
+		{
+			name:     "update followed by resync is update",
+			event:    Event{Type: EventUpdate, Old: v1Pod, New: v2Pod},
+			next:     Event{Type: EventResync, Old: v2Pod, New: v2Pod},
+			expected: Event{Type: EventUpdate, Old: v1Pod, New: v2Pod},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if actual := coalesce(tt.event, tt.next); actual != tt.expected {
+				t.Errorf("expected %s, got %s", eventString(tt.expected), eventString(actual))
+			}
+		})
+	}
+}
+
+func TestPendingEventsRestore(t *testing.T) {
+	v1Pod, v2Pod, v3Pod := testPod("a", "v1", ""), testPod("a", "v2", ""), testPod("a", "v3", "")
+
+	tests := []struct {
+		name     string
+		failed   Event
+		pending  []Event
+		expected Event
+	}{
+		{
+			name:     "restored without newer events",
+			failed:   Event{Type: EventUpdate, Old: v1Pod, New: v2Pod},
+			expected: Event{Type: EventUpdate, Old: v1Pod, New: v2Pod},
+		},
+		{
+			name:     "failed event is older than pending event",
+			failed:   Event{Type: EventUpdate, Old: v1Pod, New: v2Pod},
+			pending:  []Event{{Type: EventUpdate, Old: v2Pod, New: v3Pod}},
+			expected: Event{Type: EventUpdate, Old: v1Pod, New: v3Pod},
+		},
+		{
+			name:     "failed add stays add",
+			failed:   Event{Type: EventAdd, New: v1Pod},
+			pending:  []Event{{Type: EventUpdate, Old: v1Pod, New: v2Pod}},
+			expected: Event{Type: EventAdd, New: v2Pod},
+		},
+		{
+			name:     "object deleted while failed event was processed",
+			failed:   Event{Type: EventUpdate, Old: v1Pod, New: v2Pod},
+			pending:  []Event{{Type: EventDelete, Old: v2Pod}},
+			expected: Event{Type: EventDelete, Old: v2Pod},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			events := newPendingEvents()
+			for _, event := range tt.pending {
+				events.add("a/pod", event)
+			}
+			events.restore("a/pod", tt.failed)
+			actual, ok := events.take("a/pod")
+			if !ok {
+				t.Fatal("expected pending event")
+			}
+			if actual != tt.expected {
+				t.Errorf("expected %s, got %s", eventString(tt.expected), eventString(actual))
+			}
+			if _, ok := events.take("a/pod"); ok {
+				t.Error("expected event to be removed after take")
+			}
+		})
+	}
+}
+
+// testEventHandler records received events and returns err
+type testEventHandler struct {
+	events []Event
+	err    error
+}
+
+func (h *testEventHandler) HandleEvent(_ context.Context, _ string, event Event) (Result, error) {
+	h.events = append(h.events, event)
+	return Result{}, h.err
+}
+
+func (h *testEventHandler) Informer() cache.SharedIndexInformer {
+	return nil
+}
+
+func TestProcessEvent(t *testing.T) {
+	oldPod, newPod, storedPod := testPod("a", "pod", "node-1"), testPod("a", "pod", "node-2"), testPod("a", "pod", "node-3")
+
+	tests := []struct {
+		name     string
+		stored   *v1.Pod
+		deleted  *v1.Pod
+		pending  []Event
+		err      error
+		expected Event
+		// restored is pending event after processing, empty type if there is none
+		restored Event
+	}{
+		{
+			name:     "update gets the latest object from store",
+			stored:   storedPod,
+			pending:  []Event{{Type: EventUpdate, Old: oldPod, New: newPod}},
+			expected: Event{Type: EventUpdate, Old: oldPod, New: storedPod},
+		},
+		{
+			name:     "item without pending event is resync",
+			stored:   storedPod,
+			expected: Event{Type: EventResync, Old: storedPod, New: storedPod},
+		},
+		{
+			name:     "object not in store is deleted with the last known state",
+			deleted:  oldPod,
+			pending:  []Event{{Type: EventDelete, Old: oldPod}},
+			expected: Event{Type: EventDelete, Old: oldPod},
+		},
+		{
+			name:     "object in store with filtered add after delete is resync",
+			stored:   storedPod,
+			pending:  []Event{{Type: EventDelete, Old: oldPod}},
+			expected: Event{Type: EventResync, Old: storedPod, New: storedPod},
+		},
+		{
+			name:     "failed event is restored",
+			stored:   storedPod,
+			pending:  []Event{{Type: EventUpdate, Old: oldPod, New: newPod}},
+			err:      errors.New("test"),
+			expected: Event{Type: EventUpdate, Old: oldPod, New: storedPod},
+			restored: Event{Type: EventUpdate, Old: oldPod, New: storedPod},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			handler := &testEventHandler{err: tt.err}
+			w := &queueWorker{
+				logger:  slog.New(slog.DiscardHandler),
+				name:    "test",
+				handler: eventHandlerAdapter{handler: handler},
+				deleted: newDeletedObjects(),
+				events:  newPendingEvents(),
+			}
+			indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+			if tt.stored != nil {
+				if err := indexer.Add(tt.stored); err != nil {
+					t.Fatalf("add to indexer: %v", err)
+				}
+			}
+			if tt.deleted != nil {
+				w.deleted.set("a/pod", tt.deleted)
+			}
+			for _, event := range tt.pending {
+				w.events.add("a/pod", event)
+			}
+
+			_, err := w.processItem(context.Background(), indexer, Key{Namespace: "a", Name: "pod"})
+			if !errors.Is(err, tt.err) {
+				t.Fatalf("expected error %v, got %v", tt.err, err)
+			}
+			if len(handler.events) != 1 {
+				t.Fatalf("expected 1 handled event, got %d", len(handler.events))
+			}
+			if handler.events[0] != tt.expected {
+				t.Errorf("expected %s, got %s", eventString(tt.expected), eventString(handler.events[0]))
+			}
+			restored, _ := w.events.take("a/pod")
+			if restored != tt.restored {
+				t.Errorf("expected pending %s, got %s", eventString(tt.restored), eventString(restored))
+			}
+		})
+	}
+}
+
+// eventString returns event type and node names of its pods, so events can be compared in test output
+func eventString(event Event) string {
+	node := func(obj interface{}) string {
+		if pod, ok := obj.(*v1.Pod); ok {
+			return pod.Name + "@" + pod.Spec.NodeName
+		}
+		return "<nil>"
+	}
+	return string(event.Type) + "{old: " + node(event.Old) + ", new: " + node(event.New) + "}"
+}
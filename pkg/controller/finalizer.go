@@ -0,0 +1,104 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/validation"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/util/retry"
+)
+
+// FinalizerHandler is implemented by handlers of controllers with finalizer, Finalize is called when the object is
+// being deleted and the finalizer is removed only after Finalize returns zero Result and no error. Result with
+// requeue keeps the finalizer, e.g. while external resources are still being deleted.
+type FinalizerHandler interface {
+	Finalize(ctx context.Context, key string, value interface{}) (Result, error)
+}
+
+// finalizer adds and removes finalizer on objects, objects are patched by dynamic client, so both typed and
+// unstructured objects are supported
+type finalizer struct {
+	name     string
+	client   dynamic.Interface
+	resource schema.GroupVersionResource
+}
+
+func (f *finalizer) validate() error {
+	if errs := validation.IsQualifiedName(f.name); len(errs) != 0 {
+		return fmt.Errorf("invalid finalizer name %q: %v", f.name, errs)
+	}
+	if f.client == nil {
+		return errors.New("finalizer client cannot be nil")
+	}
+	if f.resource.Resource == "" {
+		return errors.New("finalizer resource cannot be empty")
+	}
+	return nil
+}
+
+// add adds finalizer to the object, if it is not already set
+func (f *finalizer) add(ctx context.Context, obj metav1.Object) error {
+	return f.patch(ctx, obj, func(finalizers []string) []string {
+		if slices.Contains(finalizers, f.name) {
+			return finalizers
+		}
+		return append(slices.Clone(finalizers), f.name)
+	})
+}
+
+// remove removes finalizer from the object, object that no longer exists is not an error
+func (f *finalizer) remove(ctx context.Context, obj metav1.Object) error {
+	err := f.patch(ctx, obj, func(finalizers []string) []string {
+		return slices.DeleteFunc(slices.Clone(finalizers), func(s string) bool { return s == f.name })
+	})
+	if apierrors.IsNotFound(err) {
+		return nil
+	}
+	return err
+}
+
+// patch updates object finalizers by merge patch with resource version, so concurrent changes of finalizers are not
+// overwritten. Patch is retried with the latest object on conflict.
+func (f *finalizer) patch(ctx context.Context, obj metav1.Object, update func(finalizers []string) []string) error {
+	resource := f.client.Resource(f.resource).Namespace(obj.GetNamespace())
+	finalizers, resourceVersion := obj.GetFinalizers(), obj.GetResourceVersion()
+	return retry.RetryOnConflict(retry.DefaultRetry, func() error {
+		if resourceVersion == "" {
+			latest, err := resource.Get(ctx, obj.GetName(), metav1.GetOptions{})
+			if err != nil {
+				return err
+			}
+			finalizers, resourceVersion = latest.GetFinalizers(), latest.GetResourceVersion()
+		}
+		newFinalizers := update(finalizers)
+		if slices.Equal(finalizers, newFinalizers) {
+			return nil
+		}
+		patch, err := json.Marshal(map[string]interface{}{
+			"metadata": map[string]interface{}{
+				"finalizers":      newFinalizers,
+				"resourceVersion": resourceVersion,
+			},
+		})
+		if err != nil {
+			return fmt.Errorf("marshal finalizers patch: %w", err)
+		}
+		// next attempt gets the latest object
+		resourceVersion = ""
+		_, err = resource.Patch(ctx, obj.GetName(), types.MergePatchType, patch, metav1.PatchOptions{})
+		return err
+	})
+}
+
+// pending returns true if the object is being deleted and still has the finalizer
+func (f *finalizer) pending(obj metav1.Object) bool {
+	return obj.GetDeletionTimestamp() != nil && slices.Contains(obj.GetFinalizers(), f.name)
+}
@@ -0,0 +1,64 @@
+package controller
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"k8s.io/client-go/tools/cache"
+)
+
+type Handler interface {
+	AddOrUpdate(key string, value interface{}) error
+	Delete(key string) error
+	Informer() cache.SharedIndexInformer
+}
+
+// ContextHandler is a Handler that receives context, the context is cancelled when the controller is shutting down,
+// has a deadline if item timeout is set and carries logger that can be retrieved by LoggerFromContext. Delete receives
+// the last known state of the deleted object, or nil if it is not known (e.g. requeued dead letter).
+type ContextHandler interface {
+	AddOrUpdate(ctx context.Context, key string, value interface{}) (Result, error)
+	Delete(ctx context.Context, key string, value interface{}) (Result, error)
+	Informer() cache.SharedIndexInformer
+}
+
+// Result tells the worker what to do with successfully processed item, zero value means the item is done. Requeued
+// items are not counted as failures, returning RequeueAfter on every call re-reconciles the item periodically.
+type Result struct {
+	// Requeue adds the item back to the queue immediately
+	Requeue bool
+	// RequeueAfter adds the item back to the queue after the duration, takes precedence over Requeue
+	RequeueAfter time.Duration
+}
+
+// handlerAdapter adapts Handler to ContextHandler, context and deleted object are ignored
+type handlerAdapter struct {
+	handler Handler
+}
+
+func (h handlerAdapter) AddOrUpdate(_ context.Context, key string, value interface{}) (Result, error) {
+	return Result{}, h.handler.AddOrUpdate(key, value)
+}
+
+func (h handlerAdapter) Delete(_ context.Context, key string, _ interface{}) (Result, error) {
+	return Result{}, h.handler.Delete(key)
+}
+
+func (h handlerAdapter) Informer() cache.SharedIndexInformer {
+	return h.handler.Informer()
+}
+
+type loggerKey struct{}
+
+func contextWithLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, loggerKey{}, logger)
+}
+
+// LoggerFromContext returns logger attached to the handler context, or default logger if there is none
+func LoggerFromContext(ctx context.Context) *slog.Logger {
+	if logger, ok := ctx.Value(loggerKey{}).(*slog.Logger); ok {
+		return logger
+	}
+	return slog.Default()
+}
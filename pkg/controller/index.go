@@ -0,0 +1,129 @@
+package controller
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/tools/cache"
+)
+
+// IndexFunc returns index func of objects of type T, unstructured objects are converted to T, index values of objects
+// that cannot be converted are empty
+func IndexFunc[T any](index func(obj T) []string) cache.IndexFunc {
+	return func(obj interface{}) ([]string, error) {
+		typed, err := ToTyped[T](obj)
+		if err != nil {
+			return nil, nil
+		}
+		return index(typed), nil
+	}
+}
+
+// OwnerIndexFunc indexes objects by UIDs of their owners
+func OwnerIndexFunc(obj interface{}) ([]string, error) {
+	m, ok := metaObject(obj)
+	if !ok {
+		return nil, nil
+	}
+	var uids []string
+	for _, ref := range m.GetOwnerReferences() {
+		uids = append(uids, string(ref.UID))
+	}
+	return uids, nil
+}
+
+// LabelIndexFunc indexes objects by value of the label, objects without the label are not indexed
+func LabelIndexFunc(label string) cache.IndexFunc {
+	return func(obj interface{}) ([]string, error) {
+		m, ok := metaObject(obj)
+		if !ok {
+			return nil, nil
+		}
+		if value, ok := m.GetLabels()[label]; ok {
+			return []string{value}, nil
+		}
+		return nil, nil
+	}
+}
+
+// addIndexers adds indexers to the informer, indexers that the informer already has are skipped, because informer can
+// be shared by multiple handlers that declare the same indexers
+func addIndexers(informer cache.SharedIndexInformer, indexers cache.Indexers) error {
+	existing := informer.GetIndexer().GetIndexers()
+	newIndexers := cache.Indexers{}
+	for name, indexFunc := range indexers {
+		if _, ok := existing[name]; !ok {
+			newIndexers[name] = indexFunc
+		}
+	}
+	if len(newIndexers) == 0 {
+		return nil
+	}
+	return informer.AddIndexers(newIndexers)
+}
+
+// Lister reads objects of type T from informer cache, unstructured objects are converted to T. Returned typed objects
+// are shared with the cache and must not be modified.
+type Lister[T any] struct {
+	indexer cache.Indexer
+}
+
+func NewLister[T any](informer cache.SharedIndexInformer) *Lister[T] {
+	return &Lister[T]{indexer: informer.GetIndexer()}
+}
+
+// Get returns object by namespace and name, namespace is empty for cluster scoped objects
+func (l *Lister[T]) Get(namespace, name string) (T, bool, error) {
+	var out T
+	item, exists, err := l.indexer.GetByKey(namespaceKey(namespace, name))
+	if err != nil || !exists {
+		return out, exists, err
+	}
+	out, err = ToTyped[T](item)
+	return out, err == nil, err
+}
+
+// List returns objects in all namespaces matching the selector
+func (l *Lister[T]) List(selector labels.Selector) ([]T, error) {
+	var items []interface{}
+	err := cache.ListAll(l.indexer, selector, func(item interface{}) {
+		items = append(items, item)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return toTypedList[T](items)
+}
+
+// ListNamespace returns objects in the namespace matching the selector
+func (l *Lister[T]) ListNamespace(namespace string, selector labels.Selector) ([]T, error) {
+	var items []interface{}
+	err := cache.ListAllByNamespace(l.indexer, namespace, selector, func(item interface{}) {
+		items = append(items, item)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return toTypedList[T](items)
+}
+
+// ByIndex returns objects with the value in the index, index has to be added to the informer (see WithIndexers)
+func (l *Lister[T]) ByIndex(indexName, indexedValue string) ([]T, error) {
+	items, err := l.indexer.ByIndex(indexName, indexedValue)
+	if err != nil {
+		return nil, err
+	}
+	return toTypedList[T](items)
+}
+
+func toTypedList[T any](items []interface{}) ([]T, error) {
+	out := make([]T, 0, len(items))
+	for _, item := range items {
+		typed, err := ToTyped[T](item)
+		if err != nil {
+			return nil, fmt.Errorf("list: %w", err)
+		}
+		out = append(out, typed)
+	}
+	return out, nil
+}
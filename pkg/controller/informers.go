@@ -0,0 +1,171 @@
+package controller
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/dynamic/dynamicinformer"
+	"k8s.io/client-go/informers"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/cache"
+)
+
+// Informers are shared typed and dynamic informer factories, handlers request informers from them, so handlers
+// watching the same resource in the same scope share single informer and its cache. Informers are started once by
+// the Manager.
+type Informers struct {
+	client        kubernetes.Interface
+	dynamicClient dynamic.Interface
+	resync        time.Duration
+
+	mu sync.Mutex
+	// factories are created per namespace and selectors, because factory applies them to all its informers
+	typed   map[factoryKey]informers.SharedInformerFactory
+	dynamic map[factoryKey]dynamicinformer.DynamicSharedInformerFactory
+	// multiNamespace are shared informers watching list of namespaces, keyed by resource and scope
+	multiNamespace map[string]cache.SharedIndexInformer
+	// created are informers handed out by the factories, they are started by the factories
+	created map[cache.SharedIndexInformer]struct{}
+}
+
+func NewInformers(client kubernetes.Interface, dynamicClient dynamic.Interface, resync time.Duration) *Informers {
+	return &Informers{
+		client:         client,
+		dynamicClient:  dynamicClient,
+		resync:         resync,
+		typed:          make(map[factoryKey]informers.SharedInformerFactory),
+		dynamic:        make(map[factoryKey]dynamicinformer.DynamicSharedInformerFactory),
+		multiNamespace: make(map[string]cache.SharedIndexInformer),
+		created:        make(map[cache.SharedIndexInformer]struct{}),
+	}
+}
+
+// ForResource returns shared informer for the resource limited to the scope, built-in resources are served by typed
+// informer with typed objects, other resources (e.g. CRDs) by dynamic informer with unstructured objects. Informer
+// for list of namespaces is composed of informers of individual namespaces, so cluster wide list and watch
+// permissions are not required.
+func (i *Informers) ForResource(gvr schema.GroupVersionResource, scope Scope) cache.SharedIndexInformer {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	keys := scope.factoryKeys()
+	if len(keys) == 1 {
+		return i.forResource(gvr, keys[0])
+	}
+
+	multiKey := fmt.Sprintf("%s %s", gvr, scope)
+	if informer, ok := i.multiNamespace[multiKey]; ok {
+		return informer
+	}
+	namespaceInformers := make(map[string]cache.SharedIndexInformer)
+	for _, key := range keys {
+		namespaceInformers[key.namespace] = i.forResource(gvr, key)
+	}
+	informer := newMultiNamespaceInformer(namespaceInformers)
+	i.multiNamespace[multiKey] = informer
+	i.created[informer] = struct{}{}
+	return informer
+}
+
+// forResource returns informer from factory for the key, has to be called with lock held
+func (i *Informers) forResource(gvr schema.GroupVersionResource, key factoryKey) cache.SharedIndexInformer {
+	var informer cache.SharedIndexInformer
+	if generic, err := i.typedFactory(key).ForResource(gvr); err == nil {
+		informer = generic.Informer()
+	} else {
+		informer = i.dynamicFactory(key).ForResource(gvr).Informer()
+	}
+	i.created[informer] = struct{}{}
+	return informer
+}
+
+func (i *Informers) typedFactory(key factoryKey) informers.SharedInformerFactory {
+	if factory, ok := i.typed[key]; ok {
+		return factory
+	}
+	factory := informers.NewSharedInformerFactoryWithOptions(i.client, i.resync,
+		informers.WithNamespace(key.namespace),
+		informers.WithTweakListOptions(key.tweakListOptions),
+	)
+	i.typed[key] = factory
+	return factory
+}
+
+func (i *Informers) dynamicFactory(key factoryKey) dynamicinformer.DynamicSharedInformerFactory {
+	if factory, ok := i.dynamic[key]; ok {
+		return factory
+	}
+	factory := dynamicinformer.NewFilteredDynamicSharedInformerFactory(i.dynamicClient, i.resync, key.namespace, key.tweakListOptions)
+	i.dynamic[key] = factory
+	return factory
+}
+
+// Start starts all informers requested so far, informers that are already running are not started again
+func (i *Informers) Start(stopCh <-chan struct{}) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	for _, factory := range i.typed {
+		factory.Start(stopCh)
+	}
+	for _, factory := range i.dynamic {
+		factory.Start(stopCh)
+	}
+}
+
+// WaitForCacheSync blocks until caches of all started informers are synced, returns false if stop channel is closed
+// before that
+func (i *Informers) WaitForCacheSync(stopCh <-chan struct{}) bool {
+	typed, dynamic := i.factories()
+	for _, factory := range typed {
+		for _, synced := range factory.WaitForCacheSync(stopCh) {
+			if !synced {
+				return false
+			}
+		}
+	}
+	for _, factory := range dynamic {
+		for _, synced := range factory.WaitForCacheSync(stopCh) {
+			if !synced {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Shutdown blocks until all informers started by Start stopped, stop channel passed to Start has to be closed first
+func (i *Informers) Shutdown() {
+	typed, dynamic := i.factories()
+	for _, factory := range typed {
+		factory.Shutdown()
+	}
+	for _, factory := range dynamic {
+		factory.Shutdown()
+	}
+}
+
+// factories returns copy of factories, so blocking calls on them do not hold the lock
+func (i *Informers) factories() ([]informers.SharedInformerFactory, []dynamicinformer.DynamicSharedInformerFactory) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	var typed []informers.SharedInformerFactory
+	for _, factory := range i.typed {
+		typed = append(typed, factory)
+	}
+	var dynamic []dynamicinformer.DynamicSharedInformerFactory
+	for _, factory := range i.dynamic {
+		dynamic = append(dynamic, factory)
+	}
+	return typed, dynamic
+}
+
+// contains returns true if informer was created by the factories
+func (i *Informers) contains(informer cache.SharedIndexInformer) bool {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	_, ok := i.created[informer]
+	return ok
+}
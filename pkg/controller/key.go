@@ -0,0 +1,66 @@
+package controller
+
+import (
+	"context"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/cache"
+)
+
+// Key identifies object processed by the controller. Queue items do not have UID, so all incarnations of the object
+// with the same name are processed in order by a single worker, UID is set to the incarnation passed to the handler.
+type Key struct {
+	// Resource is set by WithResource option, it is empty otherwise
+	Resource  schema.GroupVersionResource
+	Namespace string
+	Name      string
+	UID       types.UID
+}
+
+// newKey returns queue key of the resource from namespace/name key
+func newKey(resource schema.GroupVersionResource, key string) (Key, error) {
+	namespace, name, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		return Key{}, err
+	}
+	return Key{Resource: resource, Namespace: namespace, Name: name}, nil
+}
+
+// String returns namespace/name key, the same key that is passed to handlers and used by informer cache
+func (k Key) String() string {
+	if k.Namespace == "" {
+		return k.Name
+	}
+	return k.Namespace + "/" + k.Name
+}
+
+// withUID returns key with UID of the object, UID is empty if the object is not known
+func (k Key) withUID(obj interface{}) Key {
+	k.UID = objectUID(obj)
+	return k
+}
+
+func objectUID(obj interface{}) types.UID {
+	if obj == nil {
+		return ""
+	}
+	m, err := meta.Accessor(obj)
+	if err != nil {
+		return ""
+	}
+	return m.GetUID()
+}
+
+type keyKey struct{}
+
+func contextWithKey(ctx context.Context, key Key) context.Context {
+	return context.WithValue(ctx, keyKey{}, key)
+}
+
+// KeyFromContext returns key of the object passed to the handler, including resource and UID of the incarnation
+func KeyFromContext(ctx context.Context) (Key, bool) {
+	key, ok := ctx.Value(keyKey{}).(Key)
+	return key, ok
+}
@@ -0,0 +1,141 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync/atomic"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/leaderelection"
+	"k8s.io/client-go/tools/leaderelection/resourcelock"
+)
+
+type LeaderElectionConfig struct {
+	LeaseName      string
+	LeaseNamespace string
+	// Identity of this instance, hostname is used if not set
+	Identity      string
+	LeaseDuration time.Duration
+	RenewDeadline time.Duration
+	RetryPeriod   time.Duration
+}
+
+type LeaderElector struct {
+	logger *slog.Logger
+	client kubernetes.Interface
+	config LeaderElectionConfig
+	leader atomic.Bool
+}
+
+func NewLeaderElector(logger *slog.Logger, client kubernetes.Interface, config LeaderElectionConfig) (*LeaderElector, error) {
+	if config.LeaseName == "" || config.LeaseNamespace == "" {
+		return nil, errors.New("lease name and namespace are required")
+	}
+	if config.Identity == "" {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return nil, fmt.Errorf("get hostname for leader election identity: %w", err)
+		}
+		config.Identity = hostname
+	}
+
+	return &LeaderElector{
+		logger: logger.With("component", "leader elector", "identity", config.Identity),
+		client: client,
+		config: config,
+	}, nil
+}
+
+// IsLeader returns true if this instance currently holds the lease
+func (l *LeaderElector) IsLeader() bool {
+	return l.leader.Load()
+}
+
+// Run blocks until the lease is acquired and then calls run, stop channel passed to run is closed when either stopCh
+// is closed or the leadership is lost. The lease is released only after run returns, so the next leader does not start
+// processing items while this instance is still draining its queue. Error is returned if the leadership was lost.
+func (l *LeaderElector) Run(stopCh <-chan struct{}, run func(stopCh <-chan struct{})) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	leadingCh := make(chan context.Context, 1)
+	elector, err := leaderelection.NewLeaderElector(leaderelection.LeaderElectionConfig{
+		Lock: &resourcelock.LeaseLock{
+			LeaseMeta: metav1.ObjectMeta{
+				Name:      l.config.LeaseName,
+				Namespace: l.config.LeaseNamespace,
+			},
+			Client:     l.client.CoordinationV1(),
+			LockConfig: resourcelock.ResourceLockConfig{Identity: l.config.Identity},
+		},
+		LeaseDuration:   l.config.LeaseDuration,
+		RenewDeadline:   l.config.RenewDeadline,
+		RetryPeriod:     l.config.RetryPeriod,
+		ReleaseOnCancel: true,
+		Name:            l.config.LeaseName,
+		Callbacks: leaderelection.LeaderCallbacks{
+			OnStartedLeading: func(leaderCtx context.Context) {
+				l.leader.Store(true)
+				l.logger.Info(fmt.Sprintf("acquired lease %s/%s", l.config.LeaseNamespace, l.config.LeaseName))
+				leadingCh <- leaderCtx
+			},
+			OnStoppedLeading: func() {
+				l.leader.Store(false)
+				l.logger.Info(fmt.Sprintf("stopped leading lease %s/%s", l.config.LeaseNamespace, l.config.LeaseName))
+			},
+			OnNewLeader: func(identity string) {
+				if identity != l.config.Identity {
+					l.logger.Info(fmt.Sprintf("current leader is %s", identity))
+				}
+			},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("new leader elector: %w", err)
+	}
+
+	electorDone := make(chan struct{})
+	go func() {
+		defer close(electorDone)
+		elector.Run(ctx)
+	}()
+
+	l.logger.Info(fmt.Sprintf("waiting to acquire lease %s/%s", l.config.LeaseNamespace, l.config.LeaseName))
+	var leaderCtx context.Context
+	select {
+	case <-stopCh:
+		l.logger.Info("stopped before acquiring lease")
+		cancel()
+		<-electorDone
+		return nil
+	case <-electorDone:
+		return errors.New("leader election stopped before acquiring lease")
+	case leaderCtx = <-leadingCh:
+	}
+
+	runStopCh := make(chan struct{})
+	go func() {
+		select {
+		case <-stopCh:
+		case <-leaderCtx.Done():
+		}
+		close(runStopCh)
+	}()
+	run(runStopCh)
+
+	// release the lease only after run returned
+	cancel()
+	<-electorDone
+
+	select {
+	case <-stopCh:
+		return nil
+	default:
+		return errors.New("leader election lost")
+	}
+}
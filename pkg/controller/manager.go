@@ -0,0 +1,138 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+
+	"k8s.io/client-go/tools/cache"
+)
+
+// Manager runs multiple controllers in one process, controllers are started together and when one of them stops,
+// all of them are stopped. Manager owns shared informers that handlers request their informers from and event
+// recorders that controllers and handlers record events with.
+type Manager struct {
+	logger      *slog.Logger
+	informers   *Informers
+	recorders   *Recorders
+	controllers []*Controller
+}
+
+func NewManager(logger *slog.Logger, informers *Informers, recorders *Recorders) *Manager {
+	return &Manager{
+		logger:    logger.With("component", "manager"),
+		informers: informers,
+		recorders: recorders,
+	}
+}
+
+func (m *Manager) Informers() *Informers {
+	return m.informers
+}
+
+func (m *Manager) Recorders() *Recorders {
+	return m.recorders
+}
+
+// Add registers controller, controller names have to be unique
+func (m *Manager) Add(ctrl *Controller) error {
+	for _, c := range m.controllers {
+		if c.Name() == ctrl.Name() {
+			return fmt.Errorf("controller %s already added", ctrl.Name())
+		}
+	}
+	m.controllers = append(m.controllers, ctrl)
+	return nil
+}
+
+func (m *Manager) Controllers() []*Controller {
+	return m.controllers
+}
+
+// Synced returns error if any of the controllers has not synced its informer cache yet
+func (m *Manager) Synced() error {
+	var errs []error
+	for _, c := range m.controllers {
+		if err := c.Synced(); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", c.Name(), err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Healthy returns error if workers of any of the controllers stalled
+func (m *Manager) Healthy() error {
+	var errs []error
+	for _, c := range m.controllers {
+		if err := c.Healthy(); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", c.Name(), err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Run starts informers and controllers and blocks until all the controllers and informers stopped. Every informer
+// is started only once and controllers are started after all the shared informers synced. Controllers are stopped
+// when stop channel is closed, or when any of the controllers stops.
+func (m *Manager) Run(stopCh <-chan struct{}) {
+	stop := make(chan struct{})
+	var stopOnce sync.Once
+	stopAll := func() { stopOnce.Do(func() { close(stop) }) }
+	go func() {
+		select {
+		case <-stopCh:
+			stopAll()
+		case <-stop:
+		}
+	}()
+
+	// informers not created by shared factories are started and stopped with their controllers
+	m.informers.Start(stop)
+	for _, informer := range m.controllerInformers() {
+		go informer.Run(stop)
+	}
+	defer func() {
+		m.informers.Shutdown()
+		m.recorders.Shutdown()
+		m.logger.Info("shared informers and event recorders stopped")
+	}()
+
+	m.logger.Info("waiting for shared informers cache sync")
+	if !m.informers.WaitForCacheSync(stop) {
+		m.logger.Error("failed to sync shared informers")
+		return
+	}
+	m.logger.Info("shared informers cache synced")
+
+	var wg sync.WaitGroup
+	for _, c := range m.controllers {
+		wg.Add(1)
+		go func(c *Controller) {
+			defer wg.Done()
+			defer stopAll()
+			m.logger.Info(fmt.Sprintf("starting %s controller", c.Name()))
+			c.run(stop)
+			m.logger.Info(fmt.Sprintf("%s controller stopped", c.Name()))
+		}(c)
+	}
+	wg.Wait()
+	m.logger.Info("all controllers stopped")
+}
+
+// controllerInformers returns distinct controller informers, including informers of watches, that were not created
+// by shared informer factories
+func (m *Manager) controllerInformers() []cache.SharedIndexInformer {
+	var informers []cache.SharedIndexInformer
+	seen := make(map[cache.SharedIndexInformer]struct{})
+	for _, c := range m.controllers {
+		for _, informer := range c.informers() {
+			if _, ok := seen[informer]; ok || m.informers.contains(informer) {
+				continue
+			}
+			seen[informer] = struct{}{}
+			informers = append(informers, informer)
+		}
+	}
+	return informers
+}
@@ -0,0 +1,345 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/client-go/tools/cache"
+)
+
+// multiNamespaceInformer fans out to informers of individual namespaces, so list of namespaces can be watched without
+// cluster wide permissions. Event handlers, indexers and transform are added to all the namespace informers.
+type multiNamespaceInformer struct {
+	informers map[string]cache.SharedIndexInformer
+	indexer   *multiNamespaceIndexer
+}
+
+func newMultiNamespaceInformer(informers map[string]cache.SharedIndexInformer) *multiNamespaceInformer {
+	indexers := make(map[string]cache.Indexer)
+	for namespace, informer := range informers {
+		indexers[namespace] = informer.GetIndexer()
+	}
+	return &multiNamespaceInformer{
+		informers: informers,
+		indexer:   &multiNamespaceIndexer{indexers: indexers},
+	}
+}
+
+// multiNamespaceRegistration is event handler registration in all the namespace informers
+type multiNamespaceRegistration map[string]cache.ResourceEventHandlerRegistration
+
+func (r multiNamespaceRegistration) HasSynced() bool {
+	for _, registration := range r {
+		if !registration.HasSynced() {
+			return false
+		}
+	}
+	return true
+}
+
+func (i *multiNamespaceInformer) AddEventHandler(handler cache.ResourceEventHandler) (cache.ResourceEventHandlerRegistration, error) {
+	return i.addEventHandler(func(informer cache.SharedIndexInformer) (cache.ResourceEventHandlerRegistration, error) {
+		return informer.AddEventHandler(handler)
+	})
+}
+
+func (i *multiNamespaceInformer) AddEventHandlerWithResyncPeriod(handler cache.ResourceEventHandler, resyncPeriod time.Duration) (cache.ResourceEventHandlerRegistration, error) {
+	return i.addEventHandler(func(informer cache.SharedIndexInformer) (cache.ResourceEventHandlerRegistration, error) {
+		return informer.AddEventHandlerWithResyncPeriod(handler, resyncPeriod)
+	})
+}
+
+func (i *multiNamespaceInformer) AddEventHandlerWithOptions(handler cache.ResourceEventHandler, options cache.HandlerOptions) (cache.ResourceEventHandlerRegistration, error) {
+	return i.addEventHandler(func(informer cache.SharedIndexInformer) (cache.ResourceEventHandlerRegistration, error) {
+		return informer.AddEventHandlerWithOptions(handler, options)
+	})
+}
+
+func (i *multiNamespaceInformer) addEventHandler(add func(cache.SharedIndexInformer) (cache.ResourceEventHandlerRegistration, error)) (cache.ResourceEventHandlerRegistration, error) {
+	registration := make(multiNamespaceRegistration)
+	for namespace, informer := range i.informers {
+		r, err := add(informer)
+		if err != nil {
+			return nil, fmt.Errorf("namespace %s: %w", namespace, err)
+		}
+		registration[namespace] = r
+	}
+	return registration, nil
+}
+
+func (i *multiNamespaceInformer) RemoveEventHandler(handle cache.ResourceEventHandlerRegistration) error {
+	registration, ok := handle.(multiNamespaceRegistration)
+	if !ok {
+		return fmt.Errorf("unexpected event handler registration type %T", handle)
+	}
+	var errs []error
+	for namespace, r := range registration {
+		if err := i.informers[namespace].RemoveEventHandler(r); err != nil {
+			errs = append(errs, fmt.Errorf("namespace %s: %w", namespace, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (i *multiNamespaceInformer) GetStore() cache.Store {
+	return i.indexer
+}
+
+// GetController returns nil, namespace informers have their own controllers
+func (i *multiNamespaceInformer) GetController() cache.Controller {
+	return nil
+}
+
+func (i *multiNamespaceInformer) Run(stopCh <-chan struct{}) {
+	var wg sync.WaitGroup
+	for _, informer := range i.informers {
+		wg.Add(1)
+		go func(informer cache.SharedIndexInformer) {
+			defer wg.Done()
+			informer.Run(stopCh)
+		}(informer)
+	}
+	wg.Wait()
+}
+
+func (i *multiNamespaceInformer) RunWithContext(ctx context.Context) {
+	i.Run(ctx.Done())
+}
+
+func (i *multiNamespaceInformer) HasSynced() bool {
+	for _, informer := range i.informers {
+		if !informer.HasSynced() {
+			return false
+		}
+	}
+	return true
+}
+
+// LastSyncResourceVersion returns empty string, resource versions of separate watches cannot be combined
+func (i *multiNamespaceInformer) LastSyncResourceVersion() string {
+	return ""
+}
+
+func (i *multiNamespaceInformer) SetWatchErrorHandler(handler cache.WatchErrorHandler) error {
+	return i.forEach(func(informer cache.SharedIndexInformer) error {
+		return informer.SetWatchErrorHandler(handler)
+	})
+}
+
+func (i *multiNamespaceInformer) SetWatchErrorHandlerWithContext(handler cache.WatchErrorHandlerWithContext) error {
+	return i.forEach(func(informer cache.SharedIndexInformer) error {
+		return informer.SetWatchErrorHandlerWithContext(handler)
+	})
+}
+
+func (i *multiNamespaceInformer) SetTransform(handler cache.TransformFunc) error {
+	return i.forEach(func(informer cache.SharedIndexInformer) error {
+		return informer.SetTransform(handler)
+	})
+}
+
+func (i *multiNamespaceInformer) IsStopped() bool {
+	for _, informer := range i.informers {
+		if !informer.IsStopped() {
+			return false
+		}
+	}
+	return true
+}
+
+func (i *multiNamespaceInformer) AddIndexers(indexers cache.Indexers) error {
+	return i.forEach(func(informer cache.SharedIndexInformer) error {
+		return informer.AddIndexers(indexers)
+	})
+}
+
+func (i *multiNamespaceInformer) GetIndexer() cache.Indexer {
+	return i.indexer
+}
+
+func (i *multiNamespaceInformer) forEach(f func(informer cache.SharedIndexInformer) error) error {
+	var errs []error
+	for namespace, informer := range i.informers {
+		if err := f(informer); err != nil {
+			errs = append(errs, fmt.Errorf("namespace %s: %w", namespace, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// multiNamespaceIndexer reads from indexers of all the namespaces, single object operations are routed to the
+// indexer of object namespace
+type multiNamespaceIndexer struct {
+	indexers map[string]cache.Indexer
+}
+
+func (i *multiNamespaceIndexer) indexerFor(obj interface{}) (cache.Indexer, error) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	m, err := meta.Accessor(obj)
+	if err != nil {
+		return nil, fmt.Errorf("object meta: %w", err)
+	}
+	indexer, ok := i.indexers[m.GetNamespace()]
+	if !ok {
+		return nil, fmt.Errorf("namespace %s is not watched", m.GetNamespace())
+	}
+	return indexer, nil
+}
+
+func (i *multiNamespaceIndexer) Add(obj interface{}) error {
+	indexer, err := i.indexerFor(obj)
+	if err != nil {
+		return err
+	}
+	return indexer.Add(obj)
+}
+
+func (i *multiNamespaceIndexer) Update(obj interface{}) error {
+	indexer, err := i.indexerFor(obj)
+	if err != nil {
+		return err
+	}
+	return indexer.Update(obj)
+}
+
+func (i *multiNamespaceIndexer) Delete(obj interface{}) error {
+	indexer, err := i.indexerFor(obj)
+	if err != nil {
+		return err
+	}
+	return indexer.Delete(obj)
+}
+
+func (i *multiNamespaceIndexer) List() []interface{} {
+	var items []interface{}
+	for _, indexer := range i.indexers {
+		items = append(items, indexer.List()...)
+	}
+	return items
+}
+
+func (i *multiNamespaceIndexer) ListKeys() []string {
+	var keys []string
+	for _, indexer := range i.indexers {
+		keys = append(keys, indexer.ListKeys()...)
+	}
+	return keys
+}
+
+func (i *multiNamespaceIndexer) Get(obj interface{}) (interface{}, bool, error) {
+	indexer, err := i.indexerFor(obj)
+	if err != nil {
+		return nil, false, nil
+	}
+	return indexer.Get(obj)
+}
+
+func (i *multiNamespaceIndexer) GetByKey(key string) (interface{}, bool, error) {
+	namespace, _, err := cache.SplitMetaNamespaceKey(key)
+	if err != nil {
+		return nil, false, err
+	}
+	indexer, ok := i.indexers[namespace]
+	if !ok {
+		return nil, false, nil
+	}
+	return indexer.GetByKey(key)
+}
+
+// Replace replaces items of every namespace, namespaces without items are cleared
+func (i *multiNamespaceIndexer) Replace(items []interface{}, resourceVersion string) error {
+	byNamespace := make(map[string][]interface{})
+	for _, item := range items {
+		m, err := meta.Accessor(item)
+		if err != nil {
+			return fmt.Errorf("object meta: %w", err)
+		}
+		byNamespace[m.GetNamespace()] = append(byNamespace[m.GetNamespace()], item)
+	}
+	for namespace, indexer := range i.indexers {
+		if err := indexer.Replace(byNamespace[namespace], resourceVersion); err != nil {
+			return fmt.Errorf("namespace %s: %w", namespace, err)
+		}
+	}
+	return nil
+}
+
+func (i *multiNamespaceIndexer) Resync() error {
+	for namespace, indexer := range i.indexers {
+		if err := indexer.Resync(); err != nil {
+			return fmt.Errorf("namespace %s: %w", namespace, err)
+		}
+	}
+	return nil
+}
+
+func (i *multiNamespaceIndexer) Index(indexName string, obj interface{}) ([]interface{}, error) {
+	var items []interface{}
+	for _, indexer := range i.indexers {
+		namespaceItems, err := indexer.Index(indexName, obj)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, namespaceItems...)
+	}
+	return items, nil
+}
+
+func (i *multiNamespaceIndexer) IndexKeys(indexName, indexedValue string) ([]string, error) {
+	var keys []string
+	for _, indexer := range i.indexers {
+		namespaceKeys, err := indexer.IndexKeys(indexName, indexedValue)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, namespaceKeys...)
+	}
+	return keys, nil
+}
+
+func (i *multiNamespaceIndexer) ListIndexFuncValues(indexName string) []string {
+	values := make(map[string]struct{})
+	for _, indexer := range i.indexers {
+		for _, value := range indexer.ListIndexFuncValues(indexName) {
+			values[value] = struct{}{}
+		}
+	}
+	return slices.Sorted(maps.Keys(values))
+}
+
+func (i *multiNamespaceIndexer) ByIndex(indexName, indexedValue string) ([]interface{}, error) {
+	var items []interface{}
+	for _, indexer := range i.indexers {
+		namespaceItems, err := indexer.ByIndex(indexName, indexedValue)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, namespaceItems...)
+	}
+	return items, nil
+}
+
+// GetIndexers returns indexers of any of the namespaces, indexers are added to all of them
+func (i *multiNamespaceIndexer) GetIndexers() cache.Indexers {
+	for _, indexer := range i.indexers {
+		return indexer.GetIndexers()
+	}
+	return cache.Indexers{}
+}
+
+func (i *multiNamespaceIndexer) AddIndexers(newIndexers cache.Indexers) error {
+	for namespace, indexer := range i.indexers {
+		if err := indexer.AddIndexers(newIndexers); err != nil {
+			return fmt.Errorf("namespace %s: %w", namespace, err)
+		}
+	}
+	return nil
+}
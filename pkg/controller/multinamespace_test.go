@@ -0,0 +1,234 @@
+package controller
+
+import (
+	"slices"
+	"testing"
+
+	v1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/tools/cache"
+)
+
+const testNodeIndex = "node"
+
+func testPod(namespace, name, node string) *v1.Pod {
+	return &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Namespace: namespace, Name: name},
+		Spec:       v1.PodSpec{NodeName: node},
+	}
+}
+
+// testMultiNamespaceIndexer returns indexer of the namespaces with node index, pods are added to their namespaces
+func testMultiNamespaceIndexer(t *testing.T, namespaces []string, pods ...*v1.Pod) *multiNamespaceIndexer {
+	t.Helper()
+	indexers := make(map[string]cache.Indexer)
+	for _, namespace := range namespaces {
+		indexers[namespace] = cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{
+			testNodeIndex: IndexFunc(func(pod *v1.Pod) []string { return []string{pod.Spec.NodeName} }),
+		})
+	}
+	indexer := &multiNamespaceIndexer{indexers: indexers}
+	for _, pod := range pods {
+		if err := indexer.Add(pod); err != nil {
+			t.Fatalf("add pod %s/%s: %v", pod.Namespace, pod.Name, err)
+		}
+	}
+	return indexer
+}
+
+func TestMultiNamespaceIndexerGetByKey(t *testing.T) {
+	indexer := testMultiNamespaceIndexer(t, []string{"a", "b"}, testPod("a", "pod", "node-1"), testPod("b", "pod", "node-1"))
+
+	tests := []struct {
+		name   string
+		key    string
+		exists bool
+	}{
+		{name: "watched namespace", key: "a/pod", exists: true},
+		{name: "other watched namespace", key: "b/pod", exists: true},
+		{name: "missing object", key: "a/missing", exists: false},
+		{name: "namespace not watched", key: "c/pod", exists: false},
+		{name: "cluster scoped key", key: "pod", exists: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			obj, exists, err := indexer.GetByKey(tt.key)
+			if err != nil {
+				t.Fatalf("get by key %s: %v", tt.key, err)
+			}
+			if exists != tt.exists {
+				t.Fatalf("get by key %s: expected exists %t, got %t", tt.key, tt.exists, exists)
+			}
+			if exists {
+				if key, _ := cache.MetaNamespaceKeyFunc(obj); key != tt.key {
+					t.Errorf("get by key %s: got object %s", tt.key, key)
+				}
+			}
+		})
+	}
+}
+
+func TestMultiNamespaceIndexerAddNotWatchedNamespace(t *testing.T) {
+	indexer := testMultiNamespaceIndexer(t, []string{"a"})
+	if err := indexer.Add(testPod("b", "pod", "node-1")); err == nil {
+		t.Fatal("add pod in namespace that is not watched: expected error")
+	}
+}
+
+func TestMultiNamespaceIndexerReplace(t *testing.T) {
+	tests := []struct {
+		name     string
+		items    []interface{}
+		expected []string
+	}{
+		{
+			name:     "replace all namespaces",
+			items:    []interface{}{testPod("a", "new", "node-1"), testPod("b", "new", "node-1")},
+			expected: []string{"a/new", "b/new"},
+		},
+		{
+			name:     "namespace without items is cleared",
+			items:    []interface{}{testPod("a", "new", "node-1")},
+			expected: []string{"a/new"},
+		},
+		{
+			name:     "no items clears all namespaces",
+			items:    nil,
+			expected: nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			indexer := testMultiNamespaceIndexer(t, []string{"a", "b"}, testPod("a", "old", "node-1"), testPod("b", "old", "node-1"))
+			if err := indexer.Replace(tt.items, "1"); err != nil {
+				t.Fatalf("replace: %v", err)
+			}
+			if keys := slices.Sorted(slices.Values(indexer.ListKeys())); !slices.Equal(keys, tt.expected) {
+				t.Errorf("expected keys %v, got %v", tt.expected, keys)
+			}
+		})
+	}
+}
+
+func TestMultiNamespaceIndexerIndexes(t *testing.T) {
+	indexer := testMultiNamespaceIndexer(t, []string{"a", "b"},
+		testPod("a", "pod-1", "node-1"),
+		testPod("a", "pod-2", "node-2"),
+		testPod("b", "pod-1", "node-1"),
+	)
+
+	tests := []struct {
+		name     string
+		node     string
+		expected []string
+	}{
+		{name: "merged across namespaces", node: "node-1", expected: []string{"a/pod-1", "b/pod-1"}},
+		{name: "single namespace", node: "node-2", expected: []string{"a/pod-2"}},
+		{name: "no match", node: "node-3", expected: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			keys, err := indexer.IndexKeys(testNodeIndex, tt.node)
+			if err != nil {
+				t.Fatalf("index keys: %v", err)
+			}
+			if keys = slices.Sorted(slices.Values(keys)); !slices.Equal(keys, tt.expected) {
+				t.Errorf("index keys: expected %v, got %v", tt.expected, keys)
+			}
+
+			items, err := indexer.ByIndex(testNodeIndex, tt.node)
+			if err != nil {
+				t.Fatalf("by index: %v", err)
+			}
+			var itemKeys []string
+			for _, item := range items {
+				key, _ := cache.MetaNamespaceKeyFunc(item)
+				itemKeys = append(itemKeys, key)
+			}
+			if itemKeys = slices.Sorted(slices.Values(itemKeys)); !slices.Equal(itemKeys, tt.expected) {
+				t.Errorf("by index: expected %v, got %v", tt.expected, itemKeys)
+			}
+		})
+	}
+
+	if values := indexer.ListIndexFuncValues(testNodeIndex); !slices.Equal(values, []string{"node-1", "node-2"}) {
+		t.Errorf("list index func values: expected [node-1 node-2], got %v", values)
+	}
+	if _, err := indexer.ByIndex("missing", "node-1"); err == nil {
+		t.Error("by missing index: expected error")
+	}
+}
+
+// fakeInformer is SharedIndexInformer with configurable sync state, other methods are not implemented
+type fakeInformer struct {
+	cache.SharedIndexInformer
+	synced         bool
+	handlersSynced bool
+}
+
+func (i *fakeInformer) HasSynced() bool {
+	return i.synced
+}
+
+func (i *fakeInformer) AddEventHandler(cache.ResourceEventHandler) (cache.ResourceEventHandlerRegistration, error) {
+	return fakeRegistration{synced: i.handlersSynced}, nil
+}
+
+func (i *fakeInformer) GetIndexer() cache.Indexer {
+	return cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+}
+
+type fakeRegistration struct {
+	synced bool
+}
+
+func (r fakeRegistration) HasSynced() bool {
+	return r.synced
+}
+
+func TestMultiNamespaceInformerHasSynced(t *testing.T) {
+	tests := []struct {
+		name               string
+		informers          map[string]*fakeInformer
+		synced             bool
+		registrationSynced bool
+	}{
+		{
+			name:               "all synced",
+			informers:          map[string]*fakeInformer{"a": {synced: true, handlersSynced: true}, "b": {synced: true, handlersSynced: true}},
+			synced:             true,
+			registrationSynced: true,
+		},
+		{
+			name:               "one informer not synced",
+			informers:          map[string]*fakeInformer{"a": {synced: true, handlersSynced: true}, "b": {synced: false, handlersSynced: true}},
+			synced:             false,
+			registrationSynced: true,
+		},
+		{
+			name:               "one registration not synced",
+			informers:          map[string]*fakeInformer{"a": {synced: true, handlersSynced: true}, "b": {synced: true, handlersSynced: false}},
+			synced:             true,
+			registrationSynced: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			informers := make(map[string]cache.SharedIndexInformer)
+			for namespace, informer := range tt.informers {
+				informers[namespace] = informer
+			}
+			informer := newMultiNamespaceInformer(informers)
+			if synced := informer.HasSynced(); synced != tt.synced {
+				t.Errorf("informer has synced: expected %t, got %t", tt.synced, synced)
+			}
+			registration, err := informer.AddEventHandler(cache.ResourceEventHandlerFuncs{})
+			if err != nil {
+				t.Fatalf("add event handler: %v", err)
+			}
+			if synced := registration.HasSynced(); synced != tt.registrationSynced {
+				t.Errorf("registration has synced: expected %t, got %t", tt.registrationSynced, synced)
+			}
+		})
+	}
+}
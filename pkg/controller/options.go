@@ -0,0 +1,177 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"time"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
+)
+
+const (
+	defaultName         = "controller"
+	defaultWorkers      = 5
+	defaultStallTimeout = 5 * time.Minute
+	defaultItemTimeout  = 0
+)
+
+type Option func(*options)
+
+type options struct {
+	name         string
+	resource     schema.GroupVersionResource
+	workers      int
+	stallTimeout time.Duration
+	itemTimeout  time.Duration
+	retryPolicy  RetryPolicy
+	predicates   []Predicate
+	watches      []Watch
+	indexers     cache.Indexers
+	// recorder records warning events on objects that exhausted their retries, nil disables the events
+	recorder record.EventRecorder
+	// successEvents records normal events on successfully reconciled objects
+	successEvents bool
+	// finalizer is added to objects before they are handled, nil disables the finalizer
+	finalizer *finalizer
+}
+
+func newOptions(opts []Option) (options, error) {
+	o := options{
+		name:         defaultName,
+		workers:      defaultWorkers,
+		stallTimeout: defaultStallTimeout,
+		itemTimeout:  defaultItemTimeout,
+		retryPolicy:  DefaultRetryPolicy(),
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.name == "" {
+		return options{}, errors.New("name cannot be empty")
+	}
+	if o.workers < 1 {
+		return options{}, fmt.Errorf("workers must be greater than 0, got %d", o.workers)
+	}
+	if o.stallTimeout <= 0 {
+		return options{}, fmt.Errorf("stall timeout must be greater than 0, got %s", o.stallTimeout)
+	}
+	if o.itemTimeout < 0 {
+		return options{}, fmt.Errorf("item timeout cannot be negative, got %s", o.itemTimeout)
+	}
+	if err := o.retryPolicy.validate(); err != nil {
+		return options{}, err
+	}
+	for _, watch := range o.watches {
+		if watch.Informer == nil || watch.Map == nil {
+			return options{}, errors.New("watch informer and map func cannot be nil")
+		}
+	}
+	if o.successEvents && o.recorder == nil {
+		return options{}, errors.New("success events require event recorder")
+	}
+	if o.finalizer != nil {
+		if err := o.finalizer.validate(); err != nil {
+			return options{}, err
+		}
+	}
+	return o, nil
+}
+
+// WithWorkers sets number of workers that process items from the queue concurrently
+func WithWorkers(workers int) Option {
+	return func(o *options) {
+		o.workers = workers
+	}
+}
+
+// WithName sets controller name, it is used in logs and as a label on queue and handler metrics
+func WithName(name string) Option {
+	return func(o *options) {
+		o.name = name
+	}
+}
+
+// WithResource sets resource of the handled objects, it is set on keys passed to handlers (see KeyFromContext)
+func WithResource(resource schema.GroupVersionResource) Option {
+	return func(o *options) {
+		o.resource = resource
+	}
+}
+
+// WithStallTimeout sets how long workers can go without picking up an item from non-empty queue before the controller
+// is reported as unhealthy
+func WithStallTimeout(stallTimeout time.Duration) Option {
+	return func(o *options) {
+		o.stallTimeout = stallTimeout
+	}
+}
+
+// WithItemTimeout sets deadline on context passed to the handler for processing single item, 0 (default) disables the
+// deadline. Worker of item that is not processed before the deadline is released to process other items, the item is
+// retried after its handler returns. Number of released workers is limited by number of workers, when the limit is
+// reached, workers wait for their handlers.
+func WithItemTimeout(itemTimeout time.Duration) Option {
+	return func(o *options) {
+		o.itemTimeout = itemTimeout
+	}
+}
+
+// WithRetryPolicy sets how many times and how fast failed items are retried
+func WithRetryPolicy(retryPolicy RetryPolicy) Option {
+	return func(o *options) {
+		o.retryPolicy = retryPolicy
+	}
+}
+
+// WithEventRecorder records warning event using recorder on objects that exhausted their retries
+func WithEventRecorder(recorder record.EventRecorder) Option {
+	return func(o *options) {
+		o.recorder = recorder
+	}
+}
+
+// WithSuccessEvents records normal event on objects that were successfully reconciled or finalized, requires event
+// recorder to be set
+func WithSuccessEvents() Option {
+	return func(o *options) {
+		o.successEvents = true
+	}
+}
+
+// WithPredicates filters informer events, event is added to the queue only if all the predicates accept it
+func WithPredicates(predicates ...Predicate) Option {
+	return func(o *options) {
+		o.predicates = append(o.predicates, predicates...)
+	}
+}
+
+// WithWatches adds secondary informers, their events are mapped to primary objects keys and added to the queue
+func WithWatches(watches ...Watch) Option {
+	return func(o *options) {
+		o.watches = append(o.watches, watches...)
+	}
+}
+
+// WithIndexers adds indexers to the handler informer, so handler can look up related objects in the cache (see
+// Lister.ByIndex). Indexers with the same name are expected to be the same, when the informer is shared.
+func WithIndexers(indexers cache.Indexers) Option {
+	return func(o *options) {
+		if o.indexers == nil {
+			o.indexers = cache.Indexers{}
+		}
+		maps.Copy(o.indexers, indexers)
+	}
+}
+
+// WithFinalizer adds finalizer to objects of the resource before they are handled, so their deletion is not missed
+// when the controller is not running. Handler has to implement FinalizerHandler, finalizer is removed after the
+// object is finalized.
+func WithFinalizer(name string, client dynamic.Interface, resource schema.GroupVersionResource) Option {
+	return func(o *options) {
+		o.finalizer = &finalizer{name: name, client: client, resource: resource}
+	}
+}
@@ -0,0 +1,193 @@
+package controller
+
+import (
+	"maps"
+	"slices"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/tools/cache"
+)
+
+// Predicate filters informer events, event is added to the queue only if predicate returns true
+type Predicate interface {
+	Add(obj interface{}) bool
+	Update(oldObj, newObj interface{}) bool
+	Delete(obj interface{}) bool
+}
+
+// PredicateFuncs implements Predicate, nil func accepts the event
+type PredicateFuncs struct {
+	AddFunc    func(obj interface{}) bool
+	UpdateFunc func(oldObj, newObj interface{}) bool
+	DeleteFunc func(obj interface{}) bool
+}
+
+func (p PredicateFuncs) Add(obj interface{}) bool {
+	return p.AddFunc == nil || p.AddFunc(obj)
+}
+
+func (p PredicateFuncs) Update(oldObj, newObj interface{}) bool {
+	return p.UpdateFunc == nil || p.UpdateFunc(oldObj, newObj)
+}
+
+func (p PredicateFuncs) Delete(obj interface{}) bool {
+	return p.DeleteFunc == nil || p.DeleteFunc(obj)
+}
+
+// NewPredicateFunc returns predicate that applies filter to added, updated (new object) and deleted objects
+func NewPredicateFunc(filter func(obj interface{}) bool) Predicate {
+	return PredicateFuncs{
+		AddFunc:    filter,
+		UpdateFunc: func(_, newObj interface{}) bool { return filter(newObj) },
+		DeleteFunc: filter,
+	}
+}
+
+// GenerationChanged accepts updates only if metadata generation changed, so status only changes are ignored. Objects
+// without generation (e.g. config maps) never change generation, updates of these objects are always filtered out.
+func GenerationChanged() Predicate {
+	return metaUpdatePredicate(func(oldObj, newObj metav1.Object) bool {
+		return oldObj.GetGeneration() != newObj.GetGeneration()
+	})
+}
+
+// ResourceVersionChanged accepts updates only if resource version changed, so periodic resyncs are ignored
+func ResourceVersionChanged() Predicate {
+	return metaUpdatePredicate(func(oldObj, newObj metav1.Object) bool {
+		return oldObj.GetResourceVersion() != newObj.GetResourceVersion()
+	})
+}
+
+// LabelsChanged accepts updates only if object labels changed
+func LabelsChanged() Predicate {
+	return metaUpdatePredicate(func(oldObj, newObj metav1.Object) bool {
+		return !maps.Equal(oldObj.GetLabels(), newObj.GetLabels())
+	})
+}
+
+// AnnotationsChanged accepts updates only if object annotations changed
+func AnnotationsChanged() Predicate {
+	return metaUpdatePredicate(func(oldObj, newObj metav1.Object) bool {
+		return !maps.Equal(oldObj.GetAnnotations(), newObj.GetAnnotations())
+	})
+}
+
+// NamespaceSelector accepts events of objects in one of the namespaces
+func NamespaceSelector(namespaces ...string) Predicate {
+	return NewPredicateFunc(func(obj interface{}) bool {
+		o, ok := metaObject(obj)
+		return ok && slices.Contains(namespaces, o.GetNamespace())
+	})
+}
+
+// LabelSelector accepts events of objects matching the selector, update is accepted if either old or new object
+// matches, so the handler sees object that stopped matching the selector
+func LabelSelector(selector labels.Selector) Predicate {
+	matches := func(obj interface{}) bool {
+		o, ok := metaObject(obj)
+		return ok && selector.Matches(labels.Set(o.GetLabels()))
+	}
+	return PredicateFuncs{
+		AddFunc:    matches,
+		UpdateFunc: func(oldObj, newObj interface{}) bool { return matches(oldObj) || matches(newObj) },
+		DeleteFunc: matches,
+	}
+}
+
+// And accepts event only if all predicates accept it
+func And(predicates ...Predicate) Predicate {
+	return PredicateFuncs{
+		AddFunc: func(obj interface{}) bool {
+			for _, p := range predicates {
+				if !p.Add(obj) {
+					return false
+				}
+			}
+			return true
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) bool {
+			for _, p := range predicates {
+				if !p.Update(oldObj, newObj) {
+					return false
+				}
+			}
+			return true
+		},
+		DeleteFunc: func(obj interface{}) bool {
+			for _, p := range predicates {
+				if !p.Delete(obj) {
+					return false
+				}
+			}
+			return true
+		},
+	}
+}
+
+// Or accepts event if any of the predicates accepts it
+func Or(predicates ...Predicate) Predicate {
+	return PredicateFuncs{
+		AddFunc: func(obj interface{}) bool {
+			for _, p := range predicates {
+				if p.Add(obj) {
+					return true
+				}
+			}
+			return false
+		},
+		UpdateFunc: func(oldObj, newObj interface{}) bool {
+			for _, p := range predicates {
+				if p.Update(oldObj, newObj) {
+					return true
+				}
+			}
+			return false
+		},
+		DeleteFunc: func(obj interface{}) bool {
+			for _, p := range predicates {
+				if p.Delete(obj) {
+					return true
+				}
+			}
+			return false
+		},
+	}
+}
+
+// Not accepts event if predicate rejects it
+func Not(predicate Predicate) Predicate {
+	return PredicateFuncs{
+		AddFunc:    func(obj interface{}) bool { return !predicate.Add(obj) },
+		UpdateFunc: func(oldObj, newObj interface{}) bool { return !predicate.Update(oldObj, newObj) },
+		DeleteFunc: func(obj interface{}) bool { return !predicate.Delete(obj) },
+	}
+}
+
+// metaUpdatePredicate returns predicate that accepts all add and delete events and applies changed func to updates,
+// update is accepted if old or new object does not have metadata
+func metaUpdatePredicate(changed func(oldObj, newObj metav1.Object) bool) Predicate {
+	return PredicateFuncs{
+		UpdateFunc: func(oldObj, newObj interface{}) bool {
+			o, oldOk := metaObject(oldObj)
+			n, newOk := metaObject(newObj)
+			if !oldOk || !newOk {
+				return true
+			}
+			return changed(o, n)
+		},
+	}
+}
+
+// metaObject returns object metadata, deleted final state unknown tombstones are unwrapped
+func metaObject(obj interface{}) (metav1.Object, bool) {
+	if tombstone, ok := obj.(cache.DeletedFinalStateUnknown); ok {
+		obj = tombstone.Obj
+	}
+	o, err := meta.Accessor(obj)
+	if err != nil {
+		return nil, false
+	}
+	return o, true
+}
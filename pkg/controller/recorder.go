@@ -0,0 +1,34 @@
+package controller
+
+import (
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/kubernetes/scheme"
+	typedcorev1 "k8s.io/client-go/kubernetes/typed/core/v1"
+	"k8s.io/client-go/tools/record"
+)
+
+// Recorders create event recorders for controllers and their handlers, all recorders share single event broadcaster
+// that sends events to the API server. Recorders are shut down by the Manager.
+type Recorders struct {
+	broadcaster record.EventBroadcaster
+}
+
+func NewRecorders(client kubernetes.Interface) *Recorders {
+	broadcaster := record.NewBroadcaster()
+	broadcaster.StartRecordingToSink(&typedcorev1.EventSinkImpl{Interface: client.CoreV1().Events("")})
+	return &Recorders{broadcaster: broadcaster}
+}
+
+// ForController returns event recorder with event source component <name>-controller, objects that are not
+// registered in client-go scheme (e.g. CRDs) need to have kind and api version set
+func (r *Recorders) ForController(name string) record.EventRecorder {
+	return r.broadcaster.NewRecorder(scheme.Scheme, corev1.EventSource{Component: fmt.Sprintf("%s-controller", name)})
+}
+
+// Shutdown stops sending events, events recorded after shutdown are dropped
+func (r *Recorders) Shutdown() {
+	r.broadcaster.Shutdown()
+}
@@ -0,0 +1,50 @@
+package controller
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/discovery"
+	"k8s.io/client-go/discovery/cached/memory"
+	"k8s.io/client-go/restmapper"
+)
+
+// NewRESTMapper returns rest mapper that discovers resources from api server, discovery is cached and refreshed when
+// resource is not found
+func NewRESTMapper(client discovery.DiscoveryInterface) meta.RESTMapper {
+	return restmapper.NewDeferredDiscoveryRESTMapper(memory.NewMemCacheClient(client))
+}
+
+// ResolveResource resolves resource to GVR using rest mapper. Resource is group/version/resource (version/resource for
+// core group), resource[.group] or kind[.group], e.g. ec2.services.k8s.aws/v1alpha1/vpcendpointserviceconfigurations,
+// v1/pods, deployments.apps or VPCEndpointServiceConfiguration. Preferred version is used if version is not set.
+func ResolveResource(mapper meta.RESTMapper, resource string) (schema.GroupVersionResource, error) {
+	var gvr schema.GroupVersionResource
+	switch parts := strings.Split(resource, "/"); len(parts) {
+	case 3:
+		gvr = schema.GroupVersionResource{Group: parts[0], Version: parts[1], Resource: parts[2]}
+	case 2:
+		gvr = schema.GroupVersionResource{Version: parts[0], Resource: parts[1]}
+	case 1:
+		gvr = schema.ParseGroupResource(resource).WithVersion("")
+	}
+	if gvr.Resource == "" {
+		return schema.GroupVersionResource{}, fmt.Errorf("invalid resource %q, expected group/version/resource, resource[.group] or kind[.group]", resource)
+	}
+
+	resolved, err := mapper.ResourceFor(gvr)
+	if err == nil {
+		return resolved, nil
+	}
+	if gvr.Version != "" || !meta.IsNoMatchError(err) {
+		return schema.GroupVersionResource{}, fmt.Errorf("resolve resource %s: %w", resource, err)
+	}
+	// resource name is not known, it can be kind
+	mapping, kindErr := mapper.RESTMapping(schema.ParseGroupKind(resource))
+	if kindErr != nil {
+		return schema.GroupVersionResource{}, fmt.Errorf("resolve resource %s: %w", resource, err)
+	}
+	return mapping.Resource, nil
+}
@@ -0,0 +1,62 @@
+package controller
+
+import (
+	"testing"
+
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func testRESTMapper() meta.RESTMapper {
+	core := schema.GroupVersion{Version: "v1"}
+	apps := schema.GroupVersion{Group: "apps", Version: "v1"}
+	example := schema.GroupVersion{Group: "example.com", Version: "v1alpha1"}
+	mapper := meta.NewDefaultRESTMapper([]schema.GroupVersion{core, apps, example})
+	mapper.Add(core.WithKind("Pod"), meta.RESTScopeNamespace)
+	mapper.Add(apps.WithKind("Deployment"), meta.RESTScopeNamespace)
+	// kind does not match resource names, so it can be resolved only as kind
+	mapper.AddSpecific(example.WithKind("Widget"), example.WithResource("gizmos"), example.WithResource("gizmo"), meta.RESTScopeNamespace)
+	return mapper
+}
+
+func TestResolveResource(t *testing.T) {
+	pods := schema.GroupVersionResource{Version: "v1", Resource: "pods"}
+	deployments := schema.GroupVersionResource{Group: "apps", Version: "v1", Resource: "deployments"}
+	gizmos := schema.GroupVersionResource{Group: "example.com", Version: "v1alpha1", Resource: "gizmos"}
+
+	tests := []struct {
+		name     string
+		resource string
+		expected schema.GroupVersionResource
+		err      bool
+	}{
+		{name: "group/version/resource", resource: "apps/v1/deployments", expected: deployments},
+		{name: "version/resource of core group", resource: "v1/pods", expected: pods},
+		{name: "resource", resource: "pods", expected: pods},
+		{name: "resource.group", resource: "deployments.apps", expected: deployments},
+		{name: "kind.group", resource: "Deployment.apps", expected: deployments},
+		{name: "kind that is not resource name", resource: "Widget.example.com", expected: gizmos},
+		{name: "unknown resource", resource: "foo", err: true},
+		{name: "unknown version", resource: "apps/v2/deployments", err: true},
+		{name: "too many parts", resource: "a/b/c/d", err: true},
+		{name: "empty resource", resource: "apps/v1/", err: true},
+		{name: "empty", resource: "", err: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gvr, err := ResolveResource(testRESTMapper(), tt.resource)
+			if tt.err {
+				if err == nil {
+					t.Fatalf("resolve %q: expected error, got %s", tt.resource, gvr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("resolve %q: %v", tt.resource, err)
+			}
+			if gvr != tt.expected {
+				t.Errorf("resolve %q: expected %s, got %s", tt.resource, tt.expected, gvr)
+			}
+		})
+	}
+}
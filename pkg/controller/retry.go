@@ -0,0 +1,66 @@
+package controller
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"golang.org/x/time/rate"
+	"k8s.io/client-go/util/workqueue"
+)
+
+// RetryPolicy configures how failed items are retried, defaults match client-go default controller rate limiter
+type RetryPolicy struct {
+	// MaxRetries is number of retries before failed item is dropped, negative value retries forever
+	MaxRetries int
+	// BaseDelay is delay of the first retry, it doubles with every retry of the same item
+	BaseDelay time.Duration
+	// MaxDelay caps exponential delay of a single item
+	MaxDelay time.Duration
+	// QPS and Burst limit overall rate of retries of all items
+	QPS   float64
+	Burst int
+}
+
+func DefaultRetryPolicy() RetryPolicy {
+	return RetryPolicy{
+		MaxRetries: 3,
+		BaseDelay:  5 * time.Millisecond,
+		MaxDelay:   1000 * time.Second,
+		QPS:        10,
+		Burst:      100,
+	}
+}
+
+func (p RetryPolicy) validate() error {
+	if p.BaseDelay <= 0 || p.MaxDelay <= 0 {
+		return fmt.Errorf("retry base delay %s and max delay %s must be greater than 0", p.BaseDelay, p.MaxDelay)
+	}
+	if p.BaseDelay > p.MaxDelay {
+		return fmt.Errorf("retry base delay %s cannot be greater than max delay %s", p.BaseDelay, p.MaxDelay)
+	}
+	if p.QPS <= 0 || p.Burst < 1 {
+		return errors.New("retry qps and burst must be greater than 0")
+	}
+	return nil
+}
+
+// retriesExceeded returns true if item that has been already retried number of times should not be retried again
+func (p RetryPolicy) retriesExceeded(retries int) bool {
+	return p.MaxRetries >= 0 && retries >= p.MaxRetries
+}
+
+func (p RetryPolicy) maxRetriesString() string {
+	if p.MaxRetries < 0 {
+		return "unlimited"
+	}
+	return strconv.Itoa(p.MaxRetries)
+}
+
+func (p RetryPolicy) rateLimiter() workqueue.TypedRateLimiter[Key] {
+	return workqueue.NewTypedMaxOfRateLimiter(
+		workqueue.NewTypedItemExponentialFailureRateLimiter[Key](p.BaseDelay, p.MaxDelay),
+		&workqueue.TypedBucketRateLimiter[Key]{Limiter: rate.NewLimiter(rate.Limit(p.QPS), p.Burst)},
+	)
+}
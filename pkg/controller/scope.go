@@ -0,0 +1,67 @@
+package controller
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// Scope limits objects watched by informer, empty scope watches all objects in all namespaces
+type Scope struct {
+	// Namespaces to watch, empty list watches all namespaces
+	Namespaces []string
+	// LabelSelector e.g. app=web,tier!=cache
+	LabelSelector string
+	// FieldSelector e.g. spec.nodeName=node-1, supported fields depend on the resource
+	FieldSelector string
+}
+
+// Validate returns error if label or field selector cannot be parsed
+func (s Scope) Validate() error {
+	if _, err := labels.Parse(s.LabelSelector); err != nil {
+		return fmt.Errorf("label selector %q: %w", s.LabelSelector, err)
+	}
+	if _, err := fields.ParseSelector(s.FieldSelector); err != nil {
+		return fmt.Errorf("field selector %q: %w", s.FieldSelector, err)
+	}
+	return nil
+}
+
+// namespaces returns sorted unique namespaces, or single metav1.NamespaceAll if all namespaces are watched
+func (s Scope) namespaces() []string {
+	if len(s.Namespaces) == 0 || slices.Contains(s.Namespaces, metav1.NamespaceAll) {
+		return []string{metav1.NamespaceAll}
+	}
+	namespaces := slices.Clone(s.Namespaces)
+	slices.Sort(namespaces)
+	return slices.Compact(namespaces)
+}
+
+func (s Scope) String() string {
+	return fmt.Sprintf("namespaces=%s labels=%s fields=%s", strings.Join(s.namespaces(), ","), s.LabelSelector, s.FieldSelector)
+}
+
+// factoryKey identifies informer factory, factory watches single namespace with the same selectors
+type factoryKey struct {
+	namespace     string
+	labelSelector string
+	fieldSelector string
+}
+
+func (s Scope) factoryKeys() []factoryKey {
+	var keys []factoryKey
+	for _, namespace := range s.namespaces() {
+		keys = append(keys, factoryKey{namespace: namespace, labelSelector: s.LabelSelector, fieldSelector: s.FieldSelector})
+	}
+	return keys
+}
+
+// tweakListOptions sets selectors on list and watch requests, other options set by reflector are kept
+func (k factoryKey) tweakListOptions(options *metav1.ListOptions) {
+	options.LabelSelector = k.labelSelector
+	options.FieldSelector = k.fieldSelector
+}
@@ -0,0 +1,192 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"reflect"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/scheme"
+	"k8s.io/client-go/tools/cache"
+)
+
+// TypedHandler is a ContextHandler that receives objects of type T, usually pointer to API type, e.g. *v1.Pod.
+// Unstructured objects from dynamic informers are converted to T, other objects are passed as they are stored in the
+// informer cache and must not be modified. Delete receives zero value of T if the deleted object is not known.
+type TypedHandler[T any] interface {
+	AddOrUpdate(ctx context.Context, key string, obj T) (Result, error)
+	Delete(ctx context.Context, key string, obj T) (Result, error)
+	Informer() cache.SharedIndexInformer
+}
+
+// TypedFinalizerHandler is a FinalizerHandler that receives objects of type T
+type TypedFinalizerHandler[T any] interface {
+	Finalize(ctx context.Context, key string, obj T) (Result, error)
+}
+
+func NewTypedController[T any](logger *slog.Logger, handler TypedHandler[T], opts ...Option) (*Controller, error) {
+	adapter := typedHandlerAdapter[T]{handler: handler}
+	if finalizerHandler, ok := handler.(TypedFinalizerHandler[T]); ok {
+		return NewContextController(logger, struct {
+			typedHandlerAdapter[T]
+			typedFinalizerAdapter[T]
+		}{adapter, typedFinalizerAdapter[T]{handler: finalizerHandler}}, opts...)
+	}
+	return NewContextController(logger, adapter, opts...)
+}
+
+// typedHandlerAdapter adapts TypedHandler to ContextHandler
+type typedHandlerAdapter[T any] struct {
+	handler TypedHandler[T]
+}
+
+func (h typedHandlerAdapter[T]) AddOrUpdate(ctx context.Context, key string, value interface{}) (Result, error) {
+	obj, err := ToTyped[T](value)
+	if err != nil {
+		return Result{}, conversionError(key, err)
+	}
+	return h.handler.AddOrUpdate(ctx, key, obj)
+}
+
+func (h typedHandlerAdapter[T]) Delete(ctx context.Context, key string, value interface{}) (Result, error) {
+	var obj T
+	if value != nil {
+		var err error
+		if obj, err = ToTyped[T](value); err != nil {
+			return Result{}, conversionError(key, err)
+		}
+	}
+	return h.handler.Delete(ctx, key, obj)
+}
+
+func (h typedHandlerAdapter[T]) Informer() cache.SharedIndexInformer {
+	return h.handler.Informer()
+}
+
+// typedFinalizerAdapter adapts TypedFinalizerHandler to FinalizerHandler
+type typedFinalizerAdapter[T any] struct {
+	handler TypedFinalizerHandler[T]
+}
+
+func (h typedFinalizerAdapter[T]) Finalize(ctx context.Context, key string, value interface{}) (Result, error) {
+	obj, err := ToTyped[T](value)
+	if err != nil {
+		return Result{}, conversionError(key, err)
+	}
+	return h.handler.Finalize(ctx, key, obj)
+}
+
+// TypedEvent is an Event with objects of type T, Old and New are zero values when they are nil in the event
+type TypedEvent[T any] struct {
+	Type EventType
+	Old  T
+	New  T
+	// event is the original event, it is used for diff
+	event Event
+}
+
+// Diff returns paths of fields that differ between old and new object, empty for add and delete events
+func (e TypedEvent[T]) Diff() ([]string, error) {
+	return e.event.Diff()
+}
+
+// TypedEventHandler is an EventHandler that receives objects of type T
+type TypedEventHandler[T any] interface {
+	HandleEvent(ctx context.Context, key string, event TypedEvent[T]) (Result, error)
+	Informer() cache.SharedIndexInformer
+}
+
+// NewTypedEventController returns controller calling typed event handler, handler can implement TypedFinalizerHandler
+// as well
+func NewTypedEventController[T any](logger *slog.Logger, handler TypedEventHandler[T], opts ...Option) (*Controller, error) {
+	adapter := typedEventHandlerAdapter[T]{handler: handler}
+	if finalizerHandler, ok := handler.(TypedFinalizerHandler[T]); ok {
+		return NewEventController(logger, struct {
+			typedEventHandlerAdapter[T]
+			typedFinalizerAdapter[T]
+		}{adapter, typedFinalizerAdapter[T]{handler: finalizerHandler}}, opts...)
+	}
+	return NewEventController(logger, adapter, opts...)
+}
+
+// typedEventHandlerAdapter adapts TypedEventHandler to EventHandler
+type typedEventHandlerAdapter[T any] struct {
+	handler TypedEventHandler[T]
+}
+
+func (h typedEventHandlerAdapter[T]) HandleEvent(ctx context.Context, key string, event Event) (Result, error) {
+	typedEvent := TypedEvent[T]{Type: event.Type, event: event}
+	var err error
+	if event.Old != nil {
+		if typedEvent.Old, err = ToTyped[T](event.Old); err != nil {
+			return Result{}, conversionError(key, err)
+		}
+	}
+	if event.New != nil {
+		if typedEvent.New, err = ToTyped[T](event.New); err != nil {
+			return Result{}, conversionError(key, err)
+		}
+	}
+	return h.handler.HandleEvent(ctx, key, typedEvent)
+}
+
+func (h typedEventHandlerAdapter[T]) Informer() cache.SharedIndexInformer {
+	return h.handler.Informer()
+}
+
+// conversionError is permanent, object of unexpected type cannot be converted on retry
+func conversionError(key string, err error) error {
+	return Permanent(fmt.Errorf("key %s: %w", key, err))
+}
+
+// ToTyped converts informer object to T, unstructured objects are converted by default unstructured converter
+func ToTyped[T any](value interface{}) (T, error) {
+	var out T
+	switch v := value.(type) {
+	case T:
+		return v, nil
+	case *unstructured.Unstructured:
+		if err := fromUnstructured(v, &out); err != nil {
+			return out, fmt.Errorf("convert unstructured %s to %T: %w", v.GroupVersionKind(), out, err)
+		}
+		return out, nil
+	case runtime.Object:
+		// typed objects from typed informers are converted when unstructured is expected, e.g. by dynamic controller
+		if _, ok := any(out).(*unstructured.Unstructured); ok {
+			u, err := typedToUnstructured(v)
+			if err != nil {
+				return out, err
+			}
+			return any(u).(T), nil
+		}
+	}
+	return out, fmt.Errorf("object is %T type, expected %T", value, out)
+}
+
+// typedToUnstructured converts typed object to unstructured, group version kind is set from the client-go scheme,
+// because typed objects in informer cache do not have it
+func typedToUnstructured(obj runtime.Object) (*unstructured.Unstructured, error) {
+	u, err := toUnstructured(obj)
+	if err != nil {
+		return nil, err
+	}
+	if gvks, _, err := scheme.Scheme.ObjectKinds(obj); err == nil && len(gvks) > 0 {
+		u.SetGroupVersionKind(gvks[0])
+	}
+	return u, nil
+}
+
+// fromUnstructured converts unstructured object to out, if out points to a pointer, new value is allocated
+func fromUnstructured[T any](in *unstructured.Unstructured, out *T) error {
+	if t := reflect.TypeFor[T](); t.Kind() == reflect.Pointer {
+		v := reflect.New(t.Elem())
+		if err := runtime.DefaultUnstructuredConverter.FromUnstructured(in.Object, v.Interface()); err != nil {
+			return err
+		}
+		*out = v.Interface().(T)
+		return nil
+	}
+	return runtime.DefaultUnstructuredConverter.FromUnstructured(in.Object, out)
+}
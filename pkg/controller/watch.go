@@ -0,0 +1,82 @@
+package controller
+
+import (
+	"fmt"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/tools/cache"
+)
+
+// MapFunc maps secondary object to keys (namespace/name) of primary objects that are added to the queue
+type MapFunc func(obj interface{}) []string
+
+// Watch is secondary informer, changes of its objects are mapped to primary objects, e.g. change of owned object or
+// of object referenced by primary object re-reconciles the primary object
+type Watch struct {
+	Informer cache.SharedIndexInformer
+	Map      MapFunc
+	// Predicate filters secondary informer events, nil accepts all events
+	Predicate Predicate
+}
+
+// MapOwner maps object to its owners of the group and kind, owners are expected to be in the object namespace
+func MapOwner(owner schema.GroupKind) MapFunc {
+	return func(obj interface{}) []string {
+		m, ok := metaObject(obj)
+		if !ok {
+			return nil
+		}
+		var keys []string
+		for _, ref := range m.GetOwnerReferences() {
+			gv, err := schema.ParseGroupVersion(ref.APIVersion)
+			if err != nil || gv.Group != owner.Group || ref.Kind != owner.Kind {
+				continue
+			}
+			keys = append(keys, namespaceKey(m.GetNamespace(), ref.Name))
+		}
+		return keys
+	}
+}
+
+// MapLabel maps object to primary object named by the label value, value is either name of the object in the same
+// namespace or namespace/name key
+func MapLabel(label string) MapFunc {
+	return func(obj interface{}) []string {
+		m, ok := metaObject(obj)
+		if !ok {
+			return nil
+		}
+		value := m.GetLabels()[label]
+		if value == "" {
+			return nil
+		}
+		if strings.Contains(value, "/") {
+			return []string{value}
+		}
+		return []string{namespaceKey(m.GetNamespace(), value)}
+	}
+}
+
+// MapIndex maps object to primary objects that have object key (namespace/name) in the index of the primary informer,
+// e.g. index of config maps referenced by primary objects. Index has to be added to the primary informer.
+func MapIndex(primary cache.SharedIndexInformer, indexName string) MapFunc {
+	return func(obj interface{}) []string {
+		key, err := cache.DeletionHandlingMetaNamespaceKeyFunc(obj)
+		if err != nil {
+			return nil
+		}
+		keys, err := primary.GetIndexer().IndexKeys(indexName, key)
+		if err != nil {
+			return nil
+		}
+		return keys
+	}
+}
+
+func namespaceKey(namespace, name string) string {
+	if namespace == "" {
+		return name
+	}
+	return fmt.Sprintf("%s/%s", namespace, name)
+}
@@ -1,83 +1,409 @@
 package controller
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"log/slog"
+	"runtime/debug"
 	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/pete911/controller/pkg/metrics"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
 	"k8s.io/client-go/util/workqueue"
 )
 
-const maxQueueRetries = 3
-
-type Handler interface {
-	AddOrUpdate(key string, value interface{}) error
-	Delete(key string) error
-	Informer() cache.SharedIndexInformer
-}
-
 type queueWorker struct {
-	logger          *slog.Logger
-	maxQueueRetries int
-	handler         Handler
+	logger      *slog.Logger
+	name        string
+	retryPolicy RetryPolicy
+	workers     int
+	itemTimeout time.Duration
+	handler     ContextHandler
+	deadLetters *DeadLetterStore
+	deleted     *deletedObjects
+	finalizer   *finalizer
+	// events are pending informer events, nil if handler does not implement EventHandler
+	events   *pendingEvents
+	recorder record.EventRecorder
+	// successEvents records normal events on successfully processed objects
+	successEvents bool
+	// abandoned limits number of items that exceeded item timeout and released their worker, while their handlers
+	// are still running
+	abandoned   chan struct{}
+	abandonedWg sync.WaitGroup
+	// lastActivityNano is unix nano time of the last item picked up from the queue
+	lastActivityNano atomic.Int64
 }
 
-func newQueueWorker(logger *slog.Logger, handler Handler) *queueWorker {
+func newQueueWorker(logger *slog.Logger, handler ContextHandler, o options, deadLetters *DeadLetterStore, deleted *deletedObjects, events *pendingEvents) *queueWorker {
 	return &queueWorker{
-		logger:          logger.With("component", "worker"),
-		maxQueueRetries: maxQueueRetries,
-		handler:         handler,
+		logger:        logger.With("component", "worker"),
+		name:          o.name,
+		retryPolicy:   o.retryPolicy,
+		workers:       o.workers,
+		itemTimeout:   o.itemTimeout,
+		handler:       handler,
+		deadLetters:   deadLetters,
+		deleted:       deleted,
+		finalizer:     o.finalizer,
+		events:        events,
+		recorder:      o.recorder,
+		successEvents: o.successEvents,
+		abandoned:     make(chan struct{}, o.workers),
 	}
 }
 
-// run starts processing items from the queue, this call is blocking until queue is shut down
-func (w *queueWorker) run(queue workqueue.TypedRateLimitingInterface[any], indexer cache.KeyGetter) {
-	var wg sync.WaitGroup
-	for {
-		item, shutdown := queue.Get()
-		if shutdown {
-			w.logger.Info("received queue shut down")
-			w.logger.Info("waiting for items to be processed")
-			wg.Wait()
-			w.logger.Info("all items processed")
-			return
-		}
+// run starts fixed number of workers processing items from the queue, this call is blocking until queue is shut down
+// and all workers finished processing their items. Context passed to handler is derived from ctx.
+func (w *queueWorker) run(ctx context.Context, queue workqueue.TypedRateLimitingInterface[Key], indexer cache.KeyGetter) {
+	w.lastActivityNano.Store(time.Now().UnixNano())
+	defer w.lastActivityNano.Store(0)
 
+	var wg sync.WaitGroup
+	for i := 0; i < w.workers; i++ {
 		wg.Add(1)
-		go func(key interface{}) {
-			// done has to be called when we finished processing the item
-			defer queue.Done(key)
+		go func(id int) {
 			defer wg.Done()
-
-			retries := queue.NumRequeues(key)
-			if err := w.processItem(indexer, key.(string)); err != nil {
-				w.logger.Error(fmt.Sprintf("process item: %v", err))
-				if retries < maxQueueRetries {
-					// calling done in defer, but not forget, we still can retry
-					w.logger.Error(fmt.Sprintf("process item retry %d out of %d, retrying: %v", retries, maxQueueRetries, err))
-					queue.AddRateLimited(key)
-					return
-				}
-				w.logger.Error(fmt.Sprintf("process item retries exceeded, retried %d out of %d: %v", retries, maxQueueRetries, err))
+			for w.processNextItem(ctx, queue, indexer) {
 			}
+			w.logger.Debug(fmt.Sprintf("worker %d received queue shut down", id))
+		}(i)
+	}
+
+	w.logger.Info(fmt.Sprintf("started %d workers", w.workers))
+	wg.Wait()
+	// handlers of abandoned items are cancelled on shutdown as well
+	w.abandonedWg.Wait()
+	w.logger.Info("all items processed")
+}
+
+func (w *queueWorker) lastActivity() time.Time {
+	if nano := w.lastActivityNano.Load(); nano != 0 {
+		return time.Unix(0, nano)
+	}
+	return time.Time{}
+}
+
+// processNextItem waits for the next item from the queue and processes it, returns false if the queue is shut down
+func (w *queueWorker) processNextItem(ctx context.Context, queue workqueue.TypedRateLimitingInterface[Key], indexer cache.KeyGetter) bool {
+	item, shutdown := queue.Get()
+	if shutdown {
+		return false
+	}
+	w.lastActivityNano.Store(time.Now().UnixNano())
+
+	// queue is drained on shutdown, items are processed with cancelled context, so context aware handlers can return
+	// early and handlers that ignore context (including deletes) still run
+	key := item.String()
+	itemCtx, cancel := w.itemContext(ctx, key)
+	done := w.processItemSafely(itemCtx, indexer, item)
+	select {
+	case p := <-done:
+		cancel()
+		w.finishItem(ctx, queue, indexer, item, p.result, p.err)
+		return true
+	case <-itemCtx.Done():
+	}
+
+	if !errors.Is(itemCtx.Err(), context.DeadlineExceeded) || !w.abandon() {
+		// shutdown, or too many abandoned items, worker waits for the handler
+		p := <-done
+		cancel()
+		w.finishItem(ctx, queue, indexer, item, p.result, p.err)
+		return true
+	}
+	// item is not done until the handler returns, so the same key is not processed concurrently by another worker
+	metrics.ObserveHandlerTimeout(w.name)
+	w.logger.Warn(fmt.Sprintf("process item %s did not finish within item timeout %s, releasing worker", key, w.itemTimeout))
+	go func() {
+		defer w.release()
+		p := <-done
+		cancel()
+		w.finishItem(ctx, queue, indexer, item, p.result, p.err)
+	}()
+	return true
+}
+
+// finishItem marks item as done, failed item is retried and successful item is forgotten and requeued if requested.
+// Item that failed with cancelled context on shutdown is not counted as failed, queue does not accept retries anymore
+func (w *queueWorker) finishItem(ctx context.Context, queue workqueue.TypedRateLimitingInterface[Key], indexer cache.KeyGetter, item Key, result Result, err error) {
+	// done has to be called when we finished processing the item
+	defer queue.Done(item)
+	if err != nil && ctx.Err() != nil && errors.Is(err, context.Canceled) {
+		w.logger.Warn(fmt.Sprintf("process item %s cancelled, controller is shutting down: %v", item, err))
+		return
+	}
+	if err != nil {
+		w.handleError(queue, indexer, item, err)
+		return
+	}
+
+	// if no error occurs we forget this item, so it does not have any delay when another change happens
+	key := item.String()
+	queue.Forget(item)
+	w.deadLetters.succeeded(key)
+	switch {
+	case result.RequeueAfter > 0:
+		w.logger.Debug(fmt.Sprintf("process item %s requeued after %s", key, result.RequeueAfter))
+		queue.AddAfter(item, result.RequeueAfter)
+	case result.Requeue:
+		w.logger.Debug(fmt.Sprintf("process item %s requeued", key))
+		queue.Add(item)
+	}
+}
+
+// abandon reserves slot for item that exceeded item timeout, returns false if all the slots are taken
+func (w *queueWorker) abandon() bool {
+	select {
+	case w.abandoned <- struct{}{}:
+		w.abandonedWg.Add(1)
+		return true
+	default:
+		return false
+	}
+}
+
+// release frees slot of abandoned item, after its handler returned
+func (w *queueWorker) release() {
+	<-w.abandoned
+	w.abandonedWg.Done()
+}
+
+// handleError retries failed item according to error type, permanent errors and transient errors that exceeded number
+// of retries are moved to dead letters, rate limited errors are retried after requested duration
+func (w *queueWorker) handleError(queue workqueue.TypedRateLimitingInterface[Key], indexer cache.KeyGetter, item Key, err error) {
+	key := item.String()
+	retries := queue.NumRequeues(item)
+	var permanent *PermanentError
+	var rateLimited *RateLimitedError
+	switch {
+	case errors.As(err, &permanent):
+		metrics.ObserveHandlerError(w.name, errorClassPermanent)
+		w.logger.Error(fmt.Sprintf("process item %s permanent error, not retrying: %v", key, err))
+		w.dead(queue, indexer, item, err, retries+1, "PermanentError", fmt.Sprintf("%s controller failed permanently: %v", w.name, err))
+		return
+	case errors.As(err, &rateLimited) && rateLimited.After > 0:
+		// rate limited retry is not counted, adding after duration does not increase number of requeues
+		metrics.ObserveHandlerError(w.name, errorClassRateLimited)
+		w.logger.Warn(fmt.Sprintf("process item %s rate limited, retrying after %s: %v", key, rateLimited.After, err))
+		w.recordEvent(getObject(indexer, key), v1.EventTypeWarning, "RateLimited", fmt.Sprintf("%s controller rate limited, retrying after %s: %v", w.name, rateLimited.After, err))
+		queue.AddAfter(item, rateLimited.After)
+		return
+	}
 
-			// if no error occurs, or number of retries exceeded we forget this item, so it does not have any delay when another change happens
-			queue.Forget(key)
-		}(item)
+	metrics.ObserveHandlerError(w.name, errorClassTransient)
+	if !w.retryPolicy.retriesExceeded(retries) {
+		// calling done in defer, but not forget, we still can retry
+		w.logger.Error(fmt.Sprintf("process item %s retry %d out of %s, retrying: %v", key, retries, w.retryPolicy.maxRetriesString(), err))
+		w.deadLetters.failed(key, time.Now())
+		queue.AddRateLimited(item)
+		return
 	}
+	w.logger.Error(fmt.Sprintf("process item %s retries exceeded, retried %d out of %s: %v", key, retries, w.retryPolicy.maxRetriesString(), err))
+	w.dead(queue, indexer, item, err, retries+1, "RetriesExceeded", fmt.Sprintf("%s controller gave up after %d attempts: %v", w.name, retries+1, err))
+}
+
+// dead moves item to dead letters and records warning event on the object, item is forgotten, so it does not have
+// any delay when another change happens. Last known state of deleted object is dropped, so failed deletes are not kept
+// in memory, requeued dead letter is deleted with unknown (nil) state.
+func (w *queueWorker) dead(queue workqueue.TypedRateLimitingInterface[Key], indexer cache.KeyGetter, item Key, err error, attempts int, reason, message string) {
+	key := item.String()
+	queue.Forget(item)
+	w.deleted.remove(key)
+	w.deadLetters.dead(key, err, attempts, time.Now())
+	w.recordEvent(getObject(indexer, key), v1.EventTypeWarning, reason, message)
 }
 
-// processItem retrieves object by key from indexer and sends it to handler for processing
-func (w *queueWorker) processItem(indexer cache.KeyGetter, key string) error {
+// getObject returns object from indexer, nil if it does not exist
+func getObject(indexer cache.KeyGetter, key string) interface{} {
+	value, exists, err := indexer.GetByKey(key)
+	if err != nil || !exists {
+		return nil
+	}
+	return value
+}
+
+// recordSuccessEvent records normal event on successfully processed object, if success events are enabled
+func (w *queueWorker) recordSuccessEvent(value interface{}, reason, message string) {
+	if w.successEvents {
+		w.recordEvent(value, v1.EventTypeNormal, reason, message)
+	}
+}
+
+// recordEvent records event on the object, if event recorder is set
+func (w *queueWorker) recordEvent(value interface{}, eventType, reason, message string) {
+	if w.recorder == nil {
+		return
+	}
+	if obj, ok := value.(runtime.Object); ok {
+		w.recorder.Event(obj, eventType, reason, message)
+	}
+}
+
+// itemContext returns context for processing single item, with logger and deadline if item timeout is set
+func (w *queueWorker) itemContext(ctx context.Context, key string) (context.Context, context.CancelFunc) {
+	ctx = contextWithLogger(ctx, w.logger.With("key", key))
+	if w.itemTimeout > 0 {
+		return context.WithTimeout(ctx, w.itemTimeout)
+	}
+	return context.WithCancel(ctx)
+}
+
+// processed is result of processing single item
+type processed struct {
+	result Result
+	err    error
+}
+
+// processItemSafely processes item in separate goroutine and recovers from panic, panic is returned as error, so the
+// item is retried. Returned channel receives the result when processing finishes.
+func (w *queueWorker) processItemSafely(ctx context.Context, indexer cache.KeyGetter, item Key) <-chan processed {
+	done := make(chan processed, 1)
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				w.logger.Error(fmt.Sprintf("process item %s panic: %v\n%s", item, r, debug.Stack()))
+				metrics.ObserveHandlerPanic(w.name)
+				done <- processed{err: fmt.Errorf("process item %s panic: %v", item, r)}
+			}
+		}()
+		result, err := w.processItem(ctx, indexer, item)
+		done <- processed{result: result, err: err}
+	}()
+	return done
+}
+
+// processItem retrieves object by key from indexer and sends it to handler for processing, if the object is not in
+// indexer, handler delete is called with the last known object state. If the object was deleted and re-created with
+// the same name, handler delete is called for the old incarnation first, so handler can clean up its state.
+func (w *queueWorker) processItem(ctx context.Context, indexer cache.KeyGetter, item Key) (Result, error) {
+	key := item.String()
 	value, exists, err := indexer.GetByKey(key)
 	if err != nil {
-		return fmt.Errorf("get object by key %s from store: %w", key, err)
+		return Result{}, fmt.Errorf("get object by key %s from store: %w", key, err)
+	}
+	if old := w.deleted.get(key); exists && old != nil && objectUID(old) != objectUID(value) {
+		w.logger.Debug(fmt.Sprintf("key %s was re-created, calling handler delete for uid %s", key, objectUID(old)))
+		if result, err := w.delete(ctx, item, old); err != nil || result != (Result{}) {
+			return result, err
+		}
+	}
+	if w.events != nil {
+		return w.processEvent(ctx, item, value, exists)
 	}
 	if !exists {
 		w.logger.Debug(fmt.Sprintf("key %s not found in store, calling handler delete", key))
-		return w.handler.Delete(key)
+		return w.delete(ctx, item, w.deleted.get(key))
+	}
+
+	ctx = contextWithKey(ctx, item.withUID(value))
+	if w.finalizer != nil {
+		if finalized, result, err := w.finalize(ctx, key, value); finalized {
+			return result, err
+		}
 	}
 	w.logger.Debug(fmt.Sprintf("key %s found in store, calling handler add/update", key))
-	return w.handler.AddOrUpdate(key, value)
+	start := time.Now()
+	result, err := w.handler.AddOrUpdate(ctx, key, value)
+	metrics.ObserveHandlerCall(w.name, "add_or_update", start, err)
+	if err == nil {
+		w.recordSuccessEvent(value, "Reconciled", fmt.Sprintf("%s controller reconciled object", w.name))
+	}
+	return result, err
+}
+
+// delete calls handler delete with the last known state of deleted object, the state is kept for retries and requeues
+func (w *queueWorker) delete(ctx context.Context, item Key, value interface{}) (Result, error) {
+	key := item.String()
+	ctx = contextWithKey(ctx, item.withUID(value))
+	start := time.Now()
+	var result Result
+	var err error
+	if w.events != nil {
+		result, err = w.handler.(EventHandler).HandleEvent(ctx, key, Event{Type: EventDelete, Old: value})
+	} else {
+		result, err = w.handler.Delete(ctx, key, value)
+	}
+	metrics.ObserveHandlerCall(w.name, "delete", start, err)
+	if err == nil && result == (Result{}) {
+		w.deleted.remove(key)
+	}
+	return result, err
+}
+
+// processEvent sends pending event of the key to event handler, the event type is corrected by the current store
+// state, because informer events could have been filtered out. Item without pending event (requeued, mapped from watch)
+// is sent as resync, or as delete if the object is not in the store. Failed event is kept for the retry.
+func (w *queueWorker) processEvent(ctx context.Context, item Key, value interface{}, exists bool) (Result, error) {
+	key := item.String()
+	event, _ := w.events.take(key)
+	if !exists {
+		w.logger.Debug(fmt.Sprintf("key %s not found in store, calling handler delete event", key))
+		return w.delete(ctx, item, w.deleted.get(key))
+	}
+	if event.Type == "" || event.Type == EventDelete {
+		event = Event{Type: EventResync, Old: value, New: value}
+	}
+	// store has the latest object state
+	event.New = value
+
+	ctx = contextWithKey(ctx, item.withUID(value))
+	if w.finalizer != nil {
+		if finalized, result, err := w.finalize(ctx, key, value); finalized {
+			if err != nil {
+				w.events.restore(key, event)
+			}
+			return result, err
+		}
+	}
+	w.logger.Debug(fmt.Sprintf("key %s calling handler %s event", key, event.Type))
+	start := time.Now()
+	result, err := w.handler.(EventHandler).HandleEvent(ctx, key, event)
+	metrics.ObserveHandlerCall(w.name, string(event.Type), start, err)
+	if err != nil {
+		w.events.restore(key, event)
+		return result, err
+	}
+	w.recordSuccessEvent(value, "Reconciled", fmt.Sprintf("%s controller reconciled object", w.name))
+	return result, nil
+}
+
+// finalize adds finalizer to the object, or calls handler finalize and removes the finalizer if the object is being
+// deleted. Returns true if the object is being deleted and handler add/update must not be called.
+func (w *queueWorker) finalize(ctx context.Context, key string, value interface{}) (bool, Result, error) {
+	obj, err := meta.Accessor(value)
+	if err != nil {
+		return true, Result{}, fmt.Errorf("object %s meta: %w", key, err)
+	}
+	if obj.GetDeletionTimestamp() == nil {
+		if err := w.finalizer.add(ctx, obj); err != nil {
+			return true, Result{}, fmt.Errorf("add finalizer %s to %s: %w", w.finalizer.name, key, err)
+		}
+		return false, Result{}, nil
+	}
+	if !w.finalizer.pending(obj) {
+		w.logger.Debug(fmt.Sprintf("key %s is being deleted and does not have finalizer, skipping", key))
+		return true, Result{}, nil
+	}
+
+	w.logger.Debug(fmt.Sprintf("key %s is being deleted, calling handler finalize", key))
+	start := time.Now()
+	result, err := w.handler.(FinalizerHandler).Finalize(ctx, key, value)
+	metrics.ObserveHandlerCall(w.name, "finalize", start, err)
+	if err != nil || result != (Result{}) {
+		return true, result, err
+	}
+	if err := w.finalizer.remove(ctx, obj); err != nil {
+		return true, Result{}, fmt.Errorf("remove finalizer %s from %s: %w", w.finalizer.name, key, err)
+	}
+	w.logger.Debug(fmt.Sprintf("key %s finalized, finalizer removed", key))
+	w.recordSuccessEvent(value, "Finalized", fmt.Sprintf("%s controller finalized object, finalizer %s removed", w.name, w.finalizer.name))
+	return true, Result{}, nil
 }
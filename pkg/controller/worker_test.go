@@ -0,0 +1,349 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pete911/controller/pkg/metrics"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/util/workqueue"
+)
+
+// testWaitTimeout is how long tests wait for something that should happen, testQuietPeriod is how long tests wait to
+// assert that something does not happen
+const (
+	testWaitTimeout = 5 * time.Second
+	testQuietPeriod = 100 * time.Millisecond
+)
+
+// testHandler is ContextHandler calling configured funcs, not configured funcs succeed
+type testHandler struct {
+	addOrUpdate func(ctx context.Context, key string, value interface{}) (Result, error)
+	delete      func(ctx context.Context, key string, value interface{}) (Result, error)
+	informer    cache.SharedIndexInformer
+}
+
+func (h testHandler) AddOrUpdate(ctx context.Context, key string, value interface{}) (Result, error) {
+	if h.addOrUpdate == nil {
+		return Result{}, nil
+	}
+	return h.addOrUpdate(ctx, key, value)
+}
+
+func (h testHandler) Delete(ctx context.Context, key string, value interface{}) (Result, error) {
+	if h.delete == nil {
+		return Result{}, nil
+	}
+	return h.delete(ctx, key, value)
+}
+
+func (h testHandler) Informer() cache.SharedIndexInformer {
+	return h.informer
+}
+
+// testWorker returns worker named after the test, so metrics of other tests are not counted, and its queue
+func testWorker(t *testing.T, handler ContextHandler, opts ...Option) (*queueWorker, workqueue.TypedRateLimitingInterface[Key]) {
+	t.Helper()
+	o, err := newOptions(append([]Option{WithName(t.Name())}, opts...))
+	if err != nil {
+		t.Fatalf("options: %v", err)
+	}
+	queue := workqueue.NewTypedRateLimitingQueue(o.retryPolicy.rateLimiter())
+	t.Cleanup(queue.ShutDown)
+	return newQueueWorker(slog.New(slog.DiscardHandler), handler, o, NewDeadLetterStore(), newDeletedObjects(), nil), queue
+}
+
+// testIndexer returns indexer with pods in namespace "a"
+func testIndexer(t *testing.T, names ...string) cache.Indexer {
+	t.Helper()
+	indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+	for _, name := range names {
+		if err := indexer.Add(testPod("a", name, "")); err != nil {
+			t.Fatalf("add pod %s: %v", name, err)
+		}
+	}
+	return indexer
+}
+
+// testRun runs worker until the test ends, returned channel is closed when run returns
+func testRun(t *testing.T, ctx context.Context, w *queueWorker, queue workqueue.TypedRateLimitingInterface[Key], indexer cache.KeyGetter) <-chan struct{} {
+	t.Helper()
+	ctx, cancel := context.WithCancel(ctx)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		w.run(ctx, queue, indexer)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		queue.ShutDown()
+		<-done
+	})
+	return done
+}
+
+// testMetric returns value of the controller metric exposed by metrics handler, 0 if it is not exposed
+func testMetric(t *testing.T, name, controller string) float64 {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	prefix := fmt.Sprintf("%s{controller=%q} ", name, controller)
+	for line := range strings.Lines(rec.Body.String()) {
+		if value, ok := strings.CutPrefix(line, prefix); ok {
+			v, err := strconv.ParseFloat(strings.TrimSpace(value), 64)
+			if err != nil {
+				t.Fatalf("metric %s: %v", name, err)
+			}
+			return v
+		}
+	}
+	return 0
+}
+
+// receive returns the next value from the channel, test fails if nothing is received in time
+func receive(t *testing.T, ch <-chan string) string {
+	t.Helper()
+	select {
+	case v := <-ch:
+		return v
+	case <-time.After(testWaitTimeout):
+		t.Fatal("timed out waiting for value")
+		return ""
+	}
+}
+
+// notReceived fails the test if the channel receives value during quiet period
+func notReceived(t *testing.T, ch <-chan string) {
+	t.Helper()
+	select {
+	case v := <-ch:
+		t.Fatalf("unexpected value %s", v)
+	case <-time.After(testQuietPeriod):
+	}
+}
+
+// waitFor polls condition until it is true, test fails if it is not true in time
+func waitFor(t *testing.T, condition func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(testWaitTimeout)
+	for !condition() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for condition")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
+
+// blockingHandler returns handler that sends key of every add or update to started and blocks until unblock is closed
+// for the blocked keys, context is ignored as with the Handler interface
+func blockingHandler(started chan<- string, unblock <-chan struct{}, blocked ...string) testHandler {
+	return testHandler{addOrUpdate: func(_ context.Context, key string, _ interface{}) (Result, error) {
+		started <- key
+		for _, b := range blocked {
+			if key == b {
+				<-unblock
+			}
+		}
+		return Result{}, nil
+	}}
+}
+
+func TestWorkerHandlerPanic(t *testing.T) {
+	handler := testHandler{addOrUpdate: func(context.Context, string, interface{}) (Result, error) {
+		panic("test panic")
+	}}
+	w, queue := testWorker(t, handler)
+	panics := testMetric(t, "controller_handler_panics_total", t.Name())
+	item := Key{Namespace: "a", Name: "pod"}
+	queue.Add(item)
+
+	if !w.processNextItem(context.Background(), queue, testIndexer(t, "pod")) {
+		t.Fatal("process next item: queue is shut down")
+	}
+	if retries := queue.NumRequeues(item); retries != 1 {
+		t.Errorf("expected panic to be retried once, got %d retries", retries)
+	}
+	if deadLetters := w.deadLetters.List(); len(deadLetters) != 0 {
+		t.Error("expected panic not to be moved to dead letters")
+	}
+	if actual := testMetric(t, "controller_handler_panics_total", t.Name()) - panics; actual != 1 {
+		t.Errorf("expected 1 panic, got %v", actual)
+	}
+}
+
+func TestWorkerTimedOutItemIsNotProcessedConcurrently(t *testing.T) {
+	started, unblock := make(chan string, 10), make(chan struct{})
+	w, queue := testWorker(t, blockingHandler(started, unblock, "a/slow"), WithWorkers(1), WithItemTimeout(10*time.Millisecond))
+	testRun(t, context.Background(), w, queue, testIndexer(t, "slow", "fast"))
+	timeouts := testMetric(t, "controller_handler_timeouts_total", t.Name())
+
+	queue.Add(Key{Namespace: "a", Name: "slow"})
+	if key := receive(t, started); key != "a/slow" {
+		t.Fatalf("expected a/slow to start, got %s", key)
+	}
+	waitFor(t, func() bool { return len(w.abandoned) == 1 })
+
+	// only worker is released, but the same key stays in processing until its handler returns
+	queue.Add(Key{Namespace: "a", Name: "slow"})
+	queue.Add(Key{Namespace: "a", Name: "fast"})
+	if key := receive(t, started); key != "a/fast" {
+		t.Fatalf("expected a/fast to start on released worker, got %s", key)
+	}
+	notReceived(t, started)
+
+	close(unblock)
+	if key := receive(t, started); key != "a/slow" {
+		t.Fatalf("expected a/slow to start again after its handler returned, got %s", key)
+	}
+	if actual := testMetric(t, "controller_handler_timeouts_total", t.Name()) - timeouts; actual != 1 {
+		t.Errorf("expected 1 timeout, got %v", actual)
+	}
+}
+
+func TestWorkerAbandonedHandlersLimit(t *testing.T) {
+	started, unblock := make(chan string, 10), make(chan struct{})
+	w, queue := testWorker(t, blockingHandler(started, unblock, "a/slow-1", "a/slow-2"), WithWorkers(1), WithItemTimeout(10*time.Millisecond))
+	testRun(t, context.Background(), w, queue, testIndexer(t, "slow-1", "slow-2", "fast"))
+	timeouts := testMetric(t, "controller_handler_timeouts_total", t.Name())
+
+	queue.Add(Key{Namespace: "a", Name: "slow-1"})
+	receive(t, started)
+	waitFor(t, func() bool { return len(w.abandoned) == 1 })
+
+	// abandoned slot is taken, worker waits for the second slow handler instead of starting another one
+	queue.Add(Key{Namespace: "a", Name: "slow-2"})
+	if key := receive(t, started); key != "a/slow-2" {
+		t.Fatalf("expected a/slow-2 to start, got %s", key)
+	}
+	queue.Add(Key{Namespace: "a", Name: "fast"})
+	notReceived(t, started)
+	if actual := testMetric(t, "controller_handler_timeouts_total", t.Name()) - timeouts; actual != 1 {
+		t.Errorf("expected 1 abandoned item, got %v", actual)
+	}
+
+	close(unblock)
+	if key := receive(t, started); key != "a/fast" {
+		t.Fatalf("expected a/fast to start after slow handlers returned, got %s", key)
+	}
+}
+
+func TestWorkerRunWaitsForAbandonedHandlers(t *testing.T) {
+	started, unblock := make(chan string, 10), make(chan struct{})
+	w, queue := testWorker(t, blockingHandler(started, unblock, "a/slow"), WithWorkers(1), WithItemTimeout(10*time.Millisecond))
+	ctx, cancel := context.WithCancel(context.Background())
+	done := testRun(t, ctx, w, queue, testIndexer(t, "slow"))
+
+	queue.Add(Key{Namespace: "a", Name: "slow"})
+	receive(t, started)
+	waitFor(t, func() bool { return len(w.abandoned) == 1 })
+
+	cancel()
+	queue.ShutDown()
+	select {
+	case <-done:
+		t.Fatal("run returned before abandoned handler returned")
+	case <-time.After(testQuietPeriod):
+	}
+
+	close(unblock)
+	select {
+	case <-done:
+	case <-time.After(testWaitTimeout):
+		t.Fatal("run did not return after abandoned handler returned")
+	}
+	if len(w.abandoned) != 0 {
+		t.Errorf("expected abandoned slot to be released, got %d taken", len(w.abandoned))
+	}
+}
+
+// testPodUID returns pod in namespace "a" with uid
+func testPodUID(name string, uid types.UID) *v1.Pod {
+	pod := testPod("a", name, "")
+	pod.UID = uid
+	return pod
+}
+
+func TestWorkerRecreatedObject(t *testing.T) {
+	tests := []struct {
+		name           string
+		deleteResult   Result
+		deleteErr      error
+		expectedCalls  []string
+		expectedResult Result
+		expectedErr    bool
+		deletedKept    bool
+	}{
+		{
+			name:          "old incarnation is deleted before add or update",
+			expectedCalls: []string{"delete a/pod uid-a", "add or update a/pod uid-b"},
+		},
+		{
+			name:          "failed delete of old incarnation stops processing",
+			deleteErr:     errors.New("test error"),
+			expectedCalls: []string{"delete a/pod uid-a"},
+			expectedErr:   true,
+			deletedKept:   true,
+		},
+		{
+			name:           "requeued delete of old incarnation stops processing",
+			deleteResult:   Result{Requeue: true},
+			expectedCalls:  []string{"delete a/pod uid-a"},
+			expectedResult: Result{Requeue: true},
+			deletedKept:    true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls []string
+			// call records handler call, uid of the value has to match uid of the key in context
+			call := func(operation string, ctx context.Context, key string, value interface{}) {
+				item, _ := KeyFromContext(ctx)
+				if uid := objectUID(value); uid != item.UID {
+					t.Errorf("%s %s: value uid %s, context uid %s", operation, key, uid, item.UID)
+				}
+				calls = append(calls, fmt.Sprintf("%s %s %s", operation, key, item.UID))
+			}
+			handler := testHandler{
+				addOrUpdate: func(ctx context.Context, key string, value interface{}) (Result, error) {
+					call("add or update", ctx, key, value)
+					return Result{}, nil
+				},
+				delete: func(ctx context.Context, key string, value interface{}) (Result, error) {
+					call("delete", ctx, key, value)
+					return tt.deleteResult, tt.deleteErr
+				},
+			}
+			w, _ := testWorker(t, handler)
+			w.deleted.set("a/pod", testPodUID("pod", "uid-a"))
+			indexer := cache.NewIndexer(cache.MetaNamespaceKeyFunc, cache.Indexers{})
+			if err := indexer.Add(testPodUID("pod", "uid-b")); err != nil {
+				t.Fatalf("add pod: %v", err)
+			}
+
+			result, err := w.processItem(context.Background(), indexer, Key{Namespace: "a", Name: "pod"})
+			if (err != nil) != tt.expectedErr {
+				t.Errorf("expected error %t, got %v", tt.expectedErr, err)
+			}
+			if result != tt.expectedResult {
+				t.Errorf("expected result %+v, got %+v", tt.expectedResult, result)
+			}
+			if !slices.Equal(calls, tt.expectedCalls) {
+				t.Errorf("expected calls %q, got %q", tt.expectedCalls, calls)
+			}
+			if kept := w.deleted.get("a/pod") != nil; kept != tt.deletedKept {
+				t.Errorf("expected deleted object kept %t, got %t", tt.deletedKept, kept)
+			}
+		})
+	}
+}
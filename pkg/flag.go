@@ -5,11 +5,67 @@ import (
 	"fmt"
 	"log/slog"
 	"os"
+	"strconv"
 	"strings"
+	"time"
 )
 
 type Flags struct {
-	LogLevel string
+	LogLevel             string
+	HttpAddr             string
+	AdminAddr            string
+	Kube                 KubeFlags
+	Controllers          []string
+	Workers              int
+	StallTimeout         time.Duration
+	ItemTimeout          time.Duration
+	SuccessEvents        bool
+	LeaderElect          bool
+	LeaderElection       LeaderElectionFlags
+	PodRetry             RetryFlags
+	PodScope             ScopeFlags
+	PodFinalizer         string
+	EndpointSvcRetry     RetryFlags
+	EndpointSvcScope     ScopeFlags
+	EndpointSvcFinalizer string
+	Resource             string
+	ResourceRetry        RetryFlags
+	ResourceScope        ScopeFlags
+	ResourceFinalizer    string
+}
+
+type RetryFlags struct {
+	MaxRetries int
+	BaseDelay  time.Duration
+	MaxDelay   time.Duration
+	QPS        float64
+	Burst      int
+}
+
+type ScopeFlags struct {
+	Namespaces    []string
+	LabelSelector string
+	FieldSelector string
+}
+
+type KubeFlags struct {
+	Kubeconfig  string
+	Context     string
+	Master      string
+	QPS         float32
+	Burst       int
+	UserAgent   string
+	ContentType string
+	As          string
+	AsGroups    []string
+}
+
+type LeaderElectionFlags struct {
+	LeaseName      string
+	LeaseNamespace string
+	LeaseDuration  time.Duration
+	RenewDeadline  time.Duration
+	RetryPeriod    time.Duration
 }
 
 func (f Flags) SlogLevel() slog.Level {
@@ -30,6 +86,39 @@ func ParseFlags() Flags {
 	var flags Flags
 	f := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
 	f.StringVar(&flags.LogLevel, "log-level", getStringEnv("CTRL_LOG_LEVEL", "DEBUG"), "controller log level")
+	f.StringVar(&flags.HttpAddr, "http-addr", getStringEnv("CTRL_HTTP_ADDR", ":8080"), "address of http server exposing metrics and health probes")
+	f.StringVar(&flags.AdminAddr, "admin-addr", getStringEnv("CTRL_ADMIN_ADDR", "localhost:8081"), "address of http server exposing admin endpoints (dead letters), listens on localhost by default, disabled if empty")
+	f.StringVar(&flags.Kube.Kubeconfig, "kubeconfig", getStringEnv("CTRL_KUBECONFIG", ""), "path to kubeconfig, KUBECONFIG env var and ~/.kube/config are used if not set, in cluster config if there is no kubeconfig")
+	f.StringVar(&flags.Kube.Context, "context", getStringEnv("CTRL_CONTEXT", ""), "kubeconfig context to use")
+	f.StringVar(&flags.Kube.Master, "master", getStringEnv("CTRL_MASTER", ""), "kubernetes api server address, overrides kubeconfig")
+	kubeQPS := f.Float64("kube-api-qps", getFloatEnv("CTRL_KUBE_API_QPS", 20), "qps of requests to kubernetes api server")
+	f.IntVar(&flags.Kube.Burst, "kube-api-burst", getIntEnv("CTRL_KUBE_API_BURST", 30), "burst of requests to kubernetes api server")
+	f.StringVar(&flags.Kube.UserAgent, "user-agent", getStringEnv("CTRL_USER_AGENT", "controller"), "user agent of requests to kubernetes api server")
+	f.StringVar(&flags.Kube.ContentType, "kube-api-content-type", getStringEnv("CTRL_KUBE_API_CONTENT_TYPE", contentTypeJSON), "content type of requests to kubernetes api server, application/json or application/vnd.kubernetes.protobuf")
+	f.StringVar(&flags.Kube.As, "as", getStringEnv("CTRL_AS", ""), "user to impersonate")
+	asGroups := f.String("as-group", getStringEnv("CTRL_AS_GROUP", ""), "comma separated list of groups to impersonate")
+	controllers := f.String("controllers", getStringEnv("CTRL_CONTROLLERS", "pod"), "comma separated list of controllers to run: pod, endpointsvc, resource")
+	f.IntVar(&flags.Workers, "workers", getIntEnv("CTRL_WORKERS", 5), "number of workers processing items concurrently")
+	f.DurationVar(&flags.StallTimeout, "stall-timeout", getDurationEnv("CTRL_STALL_TIMEOUT", 5*time.Minute), "how long workers can go without picking up queued item before liveness probe fails")
+	f.DurationVar(&flags.ItemTimeout, "item-timeout", getDurationEnv("CTRL_ITEM_TIMEOUT", 0), "deadline for handler processing single item, worker is released if handler does not finish in time and the item is retried after handler returns, 0 disables the deadline")
+	f.BoolVar(&flags.SuccessEvents, "success-events", getBoolEnv("CTRL_SUCCESS_EVENTS", false), "record normal event on successfully reconciled objects, warning events on objects that exhausted their retries are always recorded")
+	f.BoolVar(&flags.LeaderElect, "leader-elect", getBoolEnv("CTRL_LEADER_ELECT", false), "run workers only when this instance holds the leader lease")
+	f.StringVar(&flags.LeaderElection.LeaseName, "leader-elect-lease-name", getStringEnv("CTRL_LEADER_ELECT_LEASE_NAME", "controller"), "leader election lease name")
+	f.StringVar(&flags.LeaderElection.LeaseNamespace, "leader-elect-lease-namespace", getStringEnv("CTRL_LEADER_ELECT_LEASE_NAMESPACE", "default"), "leader election lease namespace")
+	f.DurationVar(&flags.LeaderElection.LeaseDuration, "leader-elect-lease-duration", getDurationEnv("CTRL_LEADER_ELECT_LEASE_DURATION", 15*time.Second), "duration that non-leader candidates wait before trying to acquire the lease")
+	f.DurationVar(&flags.LeaderElection.RenewDeadline, "leader-elect-renew-deadline", getDurationEnv("CTRL_LEADER_ELECT_RENEW_DEADLINE", 10*time.Second), "duration that the leader retries refreshing the lease before giving up")
+	f.DurationVar(&flags.LeaderElection.RetryPeriod, "leader-elect-retry-period", getDurationEnv("CTRL_LEADER_ELECT_RETRY_PERIOD", 2*time.Second), "duration between leader election actions")
+	// pod handler retries forever with capped backoff, endpoint svc handler gives up quickly, resource handler retries few times
+	retryFlags(f, "pod", &flags.PodRetry, RetryFlags{MaxRetries: -1, BaseDelay: 100 * time.Millisecond, MaxDelay: 5 * time.Minute, QPS: 10, Burst: 100})
+	retryFlags(f, "endpointsvc", &flags.EndpointSvcRetry, RetryFlags{MaxRetries: 1, BaseDelay: time.Second, MaxDelay: 10 * time.Second, QPS: 10, Burst: 100})
+	retryFlags(f, "resource", &flags.ResourceRetry, RetryFlags{MaxRetries: 5, BaseDelay: 100 * time.Millisecond, MaxDelay: time.Minute, QPS: 10, Burst: 100})
+	scopeFlags(f, "pod", &flags.PodScope)
+	scopeFlags(f, "endpointsvc", &flags.EndpointSvcScope)
+	scopeFlags(f, "resource", &flags.ResourceScope)
+	f.StringVar(&flags.PodFinalizer, "pod-finalizer", getStringEnv("CTRL_POD_FINALIZER", ""), "pod controller finalizer, e.g. example.com/cleanup, pods are finalized even if they are deleted while controller is not running, disabled if empty")
+	f.StringVar(&flags.EndpointSvcFinalizer, "endpointsvc-finalizer", getStringEnv("CTRL_ENDPOINTSVC_FINALIZER", ""), "endpointsvc controller finalizer, e.g. example.com/cleanup, disabled if empty")
+	f.StringVar(&flags.Resource, "resource", getStringEnv("CTRL_RESOURCE", ""), "resource watched by resource controller, group/version/resource (version/resource for core group), resource[.group] or kind[.group], e.g. ec2.services.k8s.aws/v1alpha1/vpcendpointserviceconfigurations or Deployment.apps")
+	f.StringVar(&flags.ResourceFinalizer, "resource-finalizer", getStringEnv("CTRL_RESOURCE_FINALIZER", ""), "resource controller finalizer, e.g. example.com/cleanup, disabled if empty")
 
 	if err := f.Parse(os.Args[1:]); err != nil {
 		fmt.Printf("parse flags: %v", err)
@@ -39,12 +128,124 @@ func ParseFlags() Flags {
 		fmt.Printf("invalid log level %s", flags.LogLevel)
 		os.Exit(1)
 	}
+	flags.Kube.QPS = float32(*kubeQPS)
+	flags.Kube.AsGroups = splitList(*asGroups)
+	if flags.Kube.ContentType != contentTypeJSON && flags.Kube.ContentType != contentTypeProtobuf {
+		fmt.Printf("invalid kube api content type %s", flags.Kube.ContentType)
+		os.Exit(1)
+	}
+	flags.Controllers = splitList(*controllers)
+	if len(flags.Controllers) == 0 {
+		fmt.Print("no controllers set")
+		os.Exit(1)
+	}
+	for _, controller := range flags.Controllers {
+		if _, ok := map[string]struct{}{"pod": {}, "endpointsvc": {}, "resource": {}}[controller]; !ok {
+			fmt.Printf("invalid controller %s", controller)
+			os.Exit(1)
+		}
+		if controller == "resource" && flags.Resource == "" {
+			fmt.Print("resource controller requires resource to be set")
+			os.Exit(1)
+		}
+	}
+	if flags.Workers < 1 {
+		fmt.Printf("invalid number of workers %d, has to be greater than 0", flags.Workers)
+		os.Exit(1)
+	}
+	if flags.LeaderElect && flags.LeaderElection.LeaseDuration <= flags.LeaderElection.RenewDeadline {
+		fmt.Printf("leader election lease duration %s has to be greater than renew deadline %s", flags.LeaderElection.LeaseDuration, flags.LeaderElection.RenewDeadline)
+		os.Exit(1)
+	}
 	return flags
 }
 
+// retryFlags registers retry flags of a controller prefixed by its name, e.g. --pod-max-retries flag and
+// CTRL_POD_MAX_RETRIES env var
+func retryFlags(f *flag.FlagSet, name string, flags *RetryFlags, defaults RetryFlags) {
+	envPrefix := fmt.Sprintf("CTRL_%s_", strings.ToUpper(name))
+	f.IntVar(&flags.MaxRetries, name+"-max-retries", getIntEnv(envPrefix+"MAX_RETRIES", defaults.MaxRetries), name+" controller number of retries of failed item, negative value retries forever")
+	f.DurationVar(&flags.BaseDelay, name+"-retry-base-delay", getDurationEnv(envPrefix+"RETRY_BASE_DELAY", defaults.BaseDelay), name+" controller delay of the first retry, doubles with every retry")
+	f.DurationVar(&flags.MaxDelay, name+"-retry-max-delay", getDurationEnv(envPrefix+"RETRY_MAX_DELAY", defaults.MaxDelay), name+" controller maximum retry delay of single item")
+	f.Float64Var(&flags.QPS, name+"-retry-qps", getFloatEnv(envPrefix+"RETRY_QPS", defaults.QPS), name+" controller overall retry rate limit")
+	f.IntVar(&flags.Burst, name+"-retry-burst", getIntEnv(envPrefix+"RETRY_BURST", defaults.Burst), name+" controller overall retry burst")
+}
+
+// scopeFlags registers flags limiting objects watched by a controller prefixed by its name, e.g. --pod-namespaces flag
+// and CTRL_POD_NAMESPACES env var
+func scopeFlags(f *flag.FlagSet, name string, flags *ScopeFlags) {
+	envPrefix := fmt.Sprintf("CTRL_%s_", strings.ToUpper(name))
+	flags.Namespaces = splitList(getStringEnv(envPrefix+"NAMESPACES", ""))
+	f.Func(name+"-namespaces", name+" controller comma separated list of watched namespaces, all namespaces if not set", func(v string) error {
+		flags.Namespaces = splitList(v)
+		return nil
+	})
+	f.StringVar(&flags.LabelSelector, name+"-label-selector", getStringEnv(envPrefix+"LABEL_SELECTOR", ""), name+" controller label selector of watched objects, e.g. app=web")
+	f.StringVar(&flags.FieldSelector, name+"-field-selector", getStringEnv(envPrefix+"FIELD_SELECTOR", ""), name+" controller field selector of watched objects, e.g. spec.nodeName=node-1")
+}
+
+// splitList splits comma separated list and removes empty elements
+func splitList(in string) []string {
+	var out []string
+	for _, v := range strings.Split(in, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
 func getStringEnv(envName string, defaultValue string) string {
 	if env, ok := os.LookupEnv(envName); ok {
 		return env
 	}
 	return defaultValue
 }
+
+func getIntEnv(envName string, defaultValue int) int {
+	if env, ok := os.LookupEnv(envName); ok {
+		i, err := strconv.Atoi(env)
+		if err != nil {
+			fmt.Printf("invalid %s env var value %s: %v", envName, env, err)
+			os.Exit(1)
+		}
+		return i
+	}
+	return defaultValue
+}
+
+func getBoolEnv(envName string, defaultValue bool) bool {
+	if env, ok := os.LookupEnv(envName); ok {
+		b, err := strconv.ParseBool(env)
+		if err != nil {
+			fmt.Printf("invalid %s env var value %s: %v", envName, env, err)
+			os.Exit(1)
+		}
+		return b
+	}
+	return defaultValue
+}
+
+func getDurationEnv(envName string, defaultValue time.Duration) time.Duration {
+	if env, ok := os.LookupEnv(envName); ok {
+		d, err := time.ParseDuration(env)
+		if err != nil {
+			fmt.Printf("invalid %s env var value %s: %v", envName, env, err)
+			os.Exit(1)
+		}
+		return d
+	}
+	return defaultValue
+}
+
+func getFloatEnv(envName string, defaultValue float64) float64 {
+	if env, ok := os.LookupEnv(envName); ok {
+		f, err := strconv.ParseFloat(env, 64)
+		if err != nil {
+			fmt.Printf("invalid %s env var value %s: %v", envName, env, err)
+			os.Exit(1)
+		}
+		return f
+	}
+	return defaultValue
+}
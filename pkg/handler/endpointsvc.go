@@ -1,84 +1,139 @@
 package handler
 
 import (
-	"errors"
+	"context"
 	"fmt"
 	"log/slog"
 	"time"
 
+	"github.com/pete911/controller/pkg/controller"
 	"github.com/pete911/controller/pkg/types"
 
 	ackec2apis "github.com/aws-controllers-k8s/ec2-controller/apis/v1alpha1"
-	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
-	"k8s.io/apimachinery/pkg/runtime"
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime/schema"
-	"k8s.io/client-go/dynamic"
-	"k8s.io/client-go/dynamic/dynamicinformer"
 	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
 )
 
+const (
+	dnsNameStateVerified        = "verified"
+	dnsNameStateFailed          = "failed"
+	dnsNameVerificationInterval = 30 * time.Second
+	// processedCondition is status condition reporting progress of this controller
+	processedCondition = "Processed"
+)
+
+// EndpointSvcConfigMapLabel on config map names endpoint service in the same namespace that is reconciled when the
+// config map changes
+const EndpointSvcConfigMapLabel = "controller/endpointsvc"
+
+var EndpointSvcResource = schema.GroupVersionResource{Group: "ec2.services.k8s.aws", Version: "v1alpha1", Resource: "vpcendpointserviceconfigurations"}
+
 type EndpointSvc struct {
-	logger *slog.Logger
-	client dynamic.Interface
+	logger     *slog.Logger
+	informers  *controller.Informers
+	scope      controller.Scope
+	recorder   record.EventRecorder
+	conditions *controller.Conditions
 }
 
-func NewEndpointSvc(logger *slog.Logger, client dynamic.Interface) *EndpointSvc {
+func NewEndpointSvc(logger *slog.Logger, informers *controller.Informers, scope controller.Scope, recorder record.EventRecorder, conditions *controller.Conditions) *EndpointSvc {
 	h := &EndpointSvc{
-		logger: logger.With("component", "handler", "name", "endpoint svc"),
-		client: client,
+		logger:     logger.With("component", "handler", "name", "endpoint svc"),
+		informers:  informers,
+		scope:      scope,
+		recorder:   recorder,
+		conditions: conditions,
 	}
 	return h
 }
 
 func (h *EndpointSvc) Informer() cache.SharedIndexInformer {
-	gvr := schema.GroupVersionResource{Group: "ec2.services.k8s.aws", Version: "v1alpha1", Resource: "vpcendpointserviceconfigurations"}
-	return dynamicinformer.NewDynamicSharedInformerFactory(h.client, 0).ForResource(gvr).Informer()
+	return h.informers.ForResource(EndpointSvcResource, h.scope)
 }
 
-func (h *EndpointSvc) AddOrUpdate(key string, value interface{}) error {
-	h.logger.Info(fmt.Sprintf("add or update endpoint service %s: received event", key))
-	endpointSvc, err := h.valueToEndpointService(value)
-	if err != nil {
-		return err
+// Watches re-reconcile endpoint service when labeled config map changes, only labeled config maps are watched
+func (h *EndpointSvc) Watches() []controller.Watch {
+	scope := controller.Scope{Namespaces: h.scope.Namespaces, LabelSelector: EndpointSvcConfigMapLabel}
+	return []controller.Watch{
+		{
+			Informer: h.informers.ForResource(corev1.SchemeGroupVersion.WithResource("configmaps"), scope),
+			Map:      controller.MapLabel(EndpointSvcConfigMapLabel),
+		},
 	}
+}
 
+func (h *EndpointSvc) AddOrUpdate(ctx context.Context, key string, endpointSvc *ackec2apis.VPCEndpointServiceConfiguration) (controller.Result, error) {
+	h.logger.Info(fmt.Sprintf("add or update endpoint service %s: received event", key))
 	if endpointSvc.Status.PrivateDNSNameConfiguration == nil {
 		h.logger.Debug(fmt.Sprintf("endpoint svc %s does not have private dns name configuraion set, skipping", key))
-		return nil
+		return controller.Result{}, nil
 	}
 	dnsNameConfiguration := types.ToDnsNameConfiguration(endpointSvc.Status.PrivateDNSNameConfiguration)
+	if dnsNameConfiguration.State != dnsNameStateVerified {
+		h.logger.Debug(fmt.Sprintf("endpoint svc %s private dns name is in %q state, checking again in %s", key, dnsNameConfiguration.State, dnsNameVerificationInterval))
+		if dnsNameConfiguration.State == dnsNameStateFailed {
+			h.recorder.Eventf(endpointSvc, corev1.EventTypeWarning, "PrivateDNSNameVerificationFailed", "private dns name verification failed, checking again in %s", dnsNameVerificationInterval)
+		}
+		if err := h.conditions.Set(ctx, endpointSvc, controller.Condition{
+			Type:    processedCondition,
+			Status:  metav1.ConditionFalse,
+			Reason:  "PrivateDNSNameNotVerified",
+			Message: fmt.Sprintf("private dns name is in %q state", dnsNameConfiguration.State),
+		}); err != nil {
+			return controller.Result{}, fmt.Errorf("add or update endpoint service %s: set status condition: %w", key, apiError(err))
+		}
+		return controller.Result{RequeueAfter: dnsNameVerificationInterval}, nil
+	}
 
 	// TODO insert your code to do whatever
 
 	h.logger.Info(fmt.Sprintf("endpoint service %s: private dns name configuraion: %+v", key, dnsNameConfiguration))
 
-	time.Sleep(5 * time.Second) // pretend that we are doing some work on pod add/update
+	if err := sleep(ctx, 5*time.Second); err != nil { // pretend that we are doing some work on add/update
+		return controller.Result{}, fmt.Errorf("add or update endpoint service %s: %w", key, err)
+	}
+	if err := h.conditions.Set(ctx, endpointSvc, controller.Condition{
+		Type:    processedCondition,
+		Status:  metav1.ConditionTrue,
+		Reason:  "PrivateDNSNameVerified",
+		Message: "private dns name is verified",
+	}); err != nil {
+		return controller.Result{}, fmt.Errorf("add or update endpoint service %s: set status condition: %w", key, apiError(err))
+	}
 	h.logger.Info(fmt.Sprintf("add or update endpoint service %s: processed event", key))
-	return nil
+	return controller.Result{}, nil
 }
 
-func (h *EndpointSvc) Delete(key string) error {
-	h.logger.Info(fmt.Sprintf("delete vpc endpoint service %s: received event", key))
-	time.Sleep(5 * time.Second) // TODO pretend that we are doing some work on delete
+// Finalize is called when endpoint service is being deleted, if the controller runs with finalizer
+func (h *EndpointSvc) Finalize(ctx context.Context, key string, endpointSvc *ackec2apis.VPCEndpointServiceConfiguration) (controller.Result, error) {
+	h.logger.Info(fmt.Sprintf("finalize vpc endpoint service %s: received event", key))
+	if err := sleep(ctx, 5*time.Second); err != nil { // TODO pretend that we are cleaning up external resources
+		return controller.Result{}, fmt.Errorf("finalize vpc endpoint service %s: %w", key, err)
+	}
 
-	// TODO insert your code to do whatever
+	// TODO insert your code to clean up whatever was created for the endpoint service
 
-	// delete resource
-	h.logger.Info(fmt.Sprintf("delete vpc endpoint service %s: processed event", key))
-	return nil
+	h.logger.Info(fmt.Sprintf("finalize vpc endpoint service %s: processed event", key))
+	return controller.Result{}, nil
 }
 
-func (h *EndpointSvc) valueToEndpointService(value interface{}) (ackec2apis.VPCEndpointServiceConfiguration, error) {
-	if value == nil {
-		return ackec2apis.VPCEndpointServiceConfiguration{}, errors.New("cannot convert nil to VPCEndpointServiceConfiguration")
-	}
-	obj, ok := value.(*unstructured.Unstructured)
-	if !ok {
-		return ackec2apis.VPCEndpointServiceConfiguration{}, fmt.Errorf("object is %T type, expected unstructured", value)
+// Delete receives the last known endpoint service state, endpointSvc is nil if its state is not known
+func (h *EndpointSvc) Delete(ctx context.Context, key string, endpointSvc *ackec2apis.VPCEndpointServiceConfiguration) (controller.Result, error) {
+	var privateDNSName string
+	if endpointSvc != nil && endpointSvc.Spec.PrivateDNSName != nil {
+		privateDNSName = *endpointSvc.Spec.PrivateDNSName
 	}
-	var endpointSvc ackec2apis.VPCEndpointServiceConfiguration
-	if err := runtime.DefaultUnstructuredConverter.FromUnstructured(obj.Object, &endpointSvc); err != nil {
-		return ackec2apis.VPCEndpointServiceConfiguration{}, fmt.Errorf(fmt.Sprintf("convert unstructured to VPCEndpointServiceConfiguration: %v", err))
+	h.logger.Info(fmt.Sprintf("delete vpc endpoint service %s private dns name %q: received event", key, privateDNSName))
+	if err := sleep(ctx, 5*time.Second); err != nil { // TODO pretend that we are doing some work on delete
+		return controller.Result{}, fmt.Errorf("delete vpc endpoint service %s: %w", key, err)
 	}
-	return endpointSvc, nil
+
+	// TODO insert your code to do whatever
+
+	// delete resource
+	h.logger.Info(fmt.Sprintf("delete vpc endpoint service %s: processed event", key))
+	return controller.Result{}, nil
 }
@@ -0,0 +1,38 @@
+package handler
+
+import (
+	"context"
+	"time"
+
+	"github.com/pete911/controller/pkg/controller"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// defaultRateLimitedDelay is used when API server throttles the request without suggesting retry delay
+const defaultRateLimitedDelay = 5 * time.Second
+
+// sleep pretends that handler is doing some work, returns context error if the context is done before d elapses
+func sleep(ctx context.Context, d time.Duration) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(d):
+		return nil
+	}
+}
+
+// apiError classifies kubernetes API error, throttled requests are retried after suggested delay and invalid requests
+// are not retried, because the same request would be rejected again
+func apiError(err error) error {
+	switch {
+	case apierrors.IsTooManyRequests(err):
+		delay := defaultRateLimitedDelay
+		if seconds, ok := apierrors.SuggestsClientDelay(err); ok && seconds > 0 {
+			delay = time.Duration(seconds) * time.Second
+		}
+		return controller.RateLimited(err, delay)
+	case apierrors.IsInvalid(err), apierrors.IsBadRequest(err):
+		return controller.Permanent(err)
+	}
+	return err
+}
@@ -6,66 +6,143 @@ import (
 	"log/slog"
 	"time"
 
+	"github.com/pete911/controller/pkg/controller"
 	v1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
-	"k8s.io/apimachinery/pkg/runtime"
-	"k8s.io/apimachinery/pkg/watch"
-	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/tools/cache"
+	"k8s.io/client-go/tools/record"
 )
 
+const (
+	podNodeIndex  = "node"
+	podIPIndex    = "podIP"
+	podOwnerIndex = "owner"
+)
+
+var PodResource = v1.SchemeGroupVersion.WithResource("pods")
+
 type Pod struct {
 	logger    *slog.Logger
-	clientset *kubernetes.Clientset
+	informers *controller.Informers
+	scope     controller.Scope
+	recorder  record.EventRecorder
+	pods      *controller.Lister[*v1.Pod]
 }
 
-func NewPod(logger *slog.Logger, clientset *kubernetes.Clientset) *Pod {
+func NewPod(logger *slog.Logger, informers *controller.Informers, scope controller.Scope, recorder record.EventRecorder) *Pod {
 	h := &Pod{
 		logger:    logger.With("component", "handler"),
-		clientset: clientset,
+		informers: informers,
+		scope:     scope,
+		recorder:  recorder,
 	}
+	h.pods = controller.NewLister[*v1.Pod](h.Informer())
 	return h
 }
 
 func (h *Pod) Informer() cache.SharedIndexInformer {
-	return cache.NewSharedIndexInformer(
-		&cache.ListWatch{
-			ListWithContextFunc: func(ctx context.Context, options metav1.ListOptions) (runtime.Object, error) {
-				return h.clientset.CoreV1().Pods("").List(context.Background(), metav1.ListOptions{})
-			},
-			WatchFuncWithContext: func(ctx context.Context, options metav1.ListOptions) (watch.Interface, error) {
-				return h.clientset.CoreV1().Pods("").Watch(context.Background(), metav1.ListOptions{})
+	return h.informers.ForResource(PodResource, h.scope)
+}
+
+// Indexers let handler look up pods on the same node, with the same IP and with the same owner in the cache
+func (h *Pod) Indexers() cache.Indexers {
+	return cache.Indexers{
+		podNodeIndex: controller.IndexFunc(func(pod *v1.Pod) []string {
+			if pod.Spec.NodeName == "" {
+				return nil
+			}
+			return []string{pod.Spec.NodeName}
+		}),
+		podIPIndex: controller.IndexFunc(func(pod *v1.Pod) []string {
+			var ips []string
+			for _, podIP := range pod.Status.PodIPs {
+				ips = append(ips, podIP.IP)
+			}
+			return ips
+		}),
+		podOwnerIndex: controller.OwnerIndexFunc,
+	}
+}
+
+// Predicate filters out pod updates that do not change pod IP or labels, including periodic resyncs
+func (h *Pod) Predicate() controller.Predicate {
+	return controller.Or(
+		controller.LabelsChanged(),
+		controller.PredicateFuncs{
+			UpdateFunc: func(oldObj, newObj interface{}) bool {
+				oldPod, oldErr := controller.ToTyped[*v1.Pod](oldObj)
+				newPod, newErr := controller.ToTyped[*v1.Pod](newObj)
+				return oldErr != nil || newErr != nil || oldPod.Status.PodIP != newPod.Status.PodIP
 			},
 		},
-		&v1.Pod{},
-		0,
-		cache.Indexers{},
 	)
 }
 
-func (h *Pod) AddOrUpdate(key string, value interface{}) error {
-	pod := h.valueToPod(value)
+func (h *Pod) AddOrUpdate(ctx context.Context, key string, pod *v1.Pod) (controller.Result, error) {
 	if pod.Status.PodIP == "" {
 		h.logger.Debug(fmt.Sprintf("pod %s in phase %s does not have IP, skipping", key, pod.Status.Phase))
-		return nil
+		return controller.Result{}, nil
 	}
 
 	h.logger.Info(fmt.Sprintf("processing pod event %s IP %s", key, pod.Status.PodIP))
-	time.Sleep(5 * time.Second) // pretend that we are doing some work on pod add/update
+	if err := h.logRelatedPods(key, pod); err != nil {
+		return controller.Result{}, fmt.Errorf("process pod event %s: %w", key, err)
+	}
+	if err := sleep(ctx, 5*time.Second); err != nil { // pretend that we are doing some work on pod add/update
+		return controller.Result{}, fmt.Errorf("process pod event %s: %w", key, err)
+	}
 	h.logger.Info(fmt.Sprintf("processed pod event %s IP %s", key, pod.Status.PodIP))
-	return nil
+	return controller.Result{}, nil
 }
 
-func (h *Pod) Delete(key string) error {
-	h.logger.Info(fmt.Sprintf("processing delete pod event %s", key))
-	time.Sleep(5 * time.Second) // pretend that we are doing some work on pod delete
-	h.logger.Info(fmt.Sprintf("processed delete pod event %s", key))
-	return nil
+// Finalize is called when pod is being deleted, if the controller runs with finalizer
+func (h *Pod) Finalize(ctx context.Context, key string, pod *v1.Pod) (controller.Result, error) {
+	h.logger.Info(fmt.Sprintf("finalizing pod %s IP %s", key, pod.Status.PodIP))
+	if err := sleep(ctx, 5*time.Second); err != nil { // pretend that we are cleaning up external resources
+		return controller.Result{}, fmt.Errorf("finalize pod %s: %w", key, err)
+	}
+	h.logger.Info(fmt.Sprintf("finalized pod %s IP %s", key, pod.Status.PodIP))
+	return controller.Result{}, nil
 }
 
-func (h *Pod) valueToPod(value interface{}) v1.Pod {
-	if value == nil {
-		return v1.Pod{}
+// Delete receives the last known pod state, pod is nil if its state is not known
+func (h *Pod) Delete(ctx context.Context, key string, pod *v1.Pod) (controller.Result, error) {
+	var podIP string
+	if pod != nil {
+		podIP = pod.Status.PodIP
 	}
-	return *value.(*v1.Pod)
+	// pod could have been re-created with the same name, uid identifies the deleted incarnation
+	podKey, _ := controller.KeyFromContext(ctx)
+	h.logger.Info(fmt.Sprintf("processing delete pod event %s uid %s IP %s", key, podKey.UID, podIP))
+	if err := sleep(ctx, 5*time.Second); err != nil { // pretend that we are doing some work on pod delete
+		return controller.Result{}, fmt.Errorf("process delete pod event %s: %w", key, err)
+	}
+	h.logger.Info(fmt.Sprintf("processed delete pod event %s uid %s IP %s", key, podKey.UID, podIP))
+	return controller.Result{}, nil
+}
+
+// logRelatedPods logs number of pods on the same node, with the same IP (e.g. host network pods) and with the same
+// owner, pods are looked up in the informer cache. Warning event is recorded if pod that is not on host network
+// shares its IP with another pod
+func (h *Pod) logRelatedPods(key string, pod *v1.Pod) error {
+	nodePods, err := h.pods.ByIndex(podNodeIndex, pod.Spec.NodeName)
+	if err != nil {
+		return fmt.Errorf("list pods on node %s: %w", pod.Spec.NodeName, err)
+	}
+	ipPods, err := h.pods.ByIndex(podIPIndex, pod.Status.PodIP)
+	if err != nil {
+		return fmt.Errorf("list pods with IP %s: %w", pod.Status.PodIP, err)
+	}
+	var ownerPods []*v1.Pod
+	if owner := metav1.GetControllerOf(pod); owner != nil {
+		if ownerPods, err = h.pods.ByIndex(podOwnerIndex, string(owner.UID)); err != nil {
+			return fmt.Errorf("list pods of owner %s: %w", owner.Name, err)
+		}
+	}
+	h.logger.Debug(fmt.Sprintf("pod %s: %d pods on node %s, %d pods with IP %s, %d pods with the same owner",
+		key, len(nodePods), pod.Spec.NodeName, len(ipPods), pod.Status.PodIP, len(ownerPods)))
+	if !pod.Spec.HostNetwork && len(ipPods) > 1 {
+		h.recorder.Eventf(pod, v1.EventTypeWarning, "PodIPShared", "pod IP %s is shared with %d other pods", pod.Status.PodIP, len(ipPods)-1)
+	}
+	return nil
 }
@@ -0,0 +1,39 @@
+package handler
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/pete911/controller/pkg/controller"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+// Resource is an example of generic handler body, it handles objects of any resource (--resource flag) as unstructured
+type Resource struct {
+	logger *slog.Logger
+}
+
+func NewResource(logger *slog.Logger) *Resource {
+	return &Resource{
+		logger: logger.With("component", "handler", "name", "resource"),
+	}
+}
+
+func (h *Resource) AddOrUpdate(ctx context.Context, key string, obj *unstructured.Unstructured) (controller.Result, error) {
+	h.logger.Info(fmt.Sprintf("add or update %s %s generation %d", obj.GetKind(), key, obj.GetGeneration()))
+	return controller.Result{}, nil
+}
+
+// Finalize is called when object is being deleted, if the controller runs with finalizer
+func (h *Resource) Finalize(ctx context.Context, key string, obj *unstructured.Unstructured) (controller.Result, error) {
+	h.logger.Info(fmt.Sprintf("finalize %s %s", obj.GetKind(), key))
+	return controller.Result{}, nil
+}
+
+// Delete receives the last known object state, object is nil if its state is not known
+func (h *Resource) Delete(ctx context.Context, key string, obj *unstructured.Unstructured) (controller.Result, error) {
+	resourceKey, _ := controller.KeyFromContext(ctx)
+	h.logger.Info(fmt.Sprintf("delete %s %s uid %s", resourceKey.Resource.Resource, key, resourceKey.UID))
+	return controller.Result{}, nil
+}
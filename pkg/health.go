@@ -0,0 +1,47 @@
+package pkg
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+type Check func() error
+
+// Checks is http handler that responds with 200 if all the checks pass, otherwise 500 with failed checks in the body
+type Checks struct {
+	mu     sync.RWMutex
+	checks map[string]Check
+}
+
+func NewChecks() *Checks {
+	return &Checks{checks: make(map[string]Check)}
+}
+
+func (c *Checks) Add(name string, check Check) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.checks[name] = check
+}
+
+func (c *Checks) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+
+	var failed []string
+	for name, check := range c.checks {
+		if err := check(); err != nil {
+			failed = append(failed, fmt.Sprintf("%s: %v", name, err))
+		}
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	if len(failed) != 0 {
+		sort.Strings(failed)
+		w.WriteHeader(http.StatusInternalServerError)
+		fmt.Fprintln(w, strings.Join(failed, "\n"))
+		return
+	}
+	fmt.Fprintln(w, "ok")
+}
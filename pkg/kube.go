@@ -0,0 +1,45 @@
+package pkg
+
+import (
+	"fmt"
+
+	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+const (
+	contentTypeJSON     = "application/json"
+	contentTypeProtobuf = "application/vnd.kubernetes.protobuf"
+)
+
+// NewRestConfig loads kubeconfig, either from the flag, KUBECONFIG env var or ~/.kube/config, and falls back to in
+// cluster config if there is none. Client settings from flags are applied to the loaded config.
+func NewRestConfig(flags KubeFlags) (*rest.Config, error) {
+	loadingRules := clientcmd.NewDefaultClientConfigLoadingRules()
+	loadingRules.ExplicitPath = flags.Kubeconfig
+	overrides := &clientcmd.ConfigOverrides{CurrentContext: flags.Context}
+	overrides.ClusterInfo.Server = flags.Master
+
+	cfg, err := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(loadingRules, overrides).ClientConfig()
+	if err != nil {
+		return nil, fmt.Errorf("load kubeconfig: %w", err)
+	}
+
+	cfg.QPS = flags.QPS
+	cfg.Burst = flags.Burst
+	if flags.UserAgent != "" {
+		cfg.UserAgent = flags.UserAgent
+	}
+	// dynamic client always uses json, protobuf applies only to typed clients
+	if flags.ContentType == contentTypeProtobuf {
+		cfg.ContentType = contentTypeProtobuf
+		cfg.AcceptContentTypes = fmt.Sprintf("%s,%s", contentTypeProtobuf, contentTypeJSON)
+	}
+	if flags.As != "" || len(flags.AsGroups) != 0 {
+		cfg.Impersonate = rest.ImpersonationConfig{
+			UserName: flags.As,
+			Groups:   flags.AsGroups,
+		}
+	}
+	return cfg, nil
+}
@@ -0,0 +1,62 @@
+package metrics
+
+import (
+	"context"
+	"net/url"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	clientmetrics "k8s.io/client-go/tools/metrics"
+)
+
+const clientSubsystem = "rest_client"
+
+var (
+	clientRequestLatency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: clientSubsystem,
+		Name:      "request_duration_seconds",
+		Help:      "Request latency in seconds by verb and host.",
+		Buckets:   []float64{0.005, 0.025, 0.1, 0.25, 0.5, 1, 2, 4, 8, 15, 30, 60},
+	}, []string{"verb", "host"})
+
+	clientRateLimiterLatency = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: clientSubsystem,
+		Name:      "rate_limiter_duration_seconds",
+		Help:      "Client side rate limiter latency in seconds by verb and host.",
+		Buckets:   []float64{0.005, 0.025, 0.1, 0.25, 0.5, 1, 2, 4, 8, 15, 30, 60},
+	}, []string{"verb", "host"})
+
+	clientRequestResult = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: clientSubsystem,
+		Name:      "requests_total",
+		Help:      "Number of HTTP requests by status code, method and host.",
+	}, []string{"code", "method", "host"})
+)
+
+func registerClientMetrics() {
+	registry.MustRegister(clientRequestLatency, clientRateLimiterLatency, clientRequestResult)
+	clientmetrics.Register(clientmetrics.RegisterOpts{
+		RequestLatency:     latencyAdapter{metric: clientRequestLatency},
+		RateLimiterLatency: latencyAdapter{metric: clientRateLimiterLatency},
+		RequestResult:      resultAdapter{metric: clientRequestResult},
+	})
+}
+
+type latencyAdapter struct {
+	metric *prometheus.HistogramVec
+}
+
+func (l latencyAdapter) Observe(_ context.Context, verb string, u url.URL, latency time.Duration) {
+	l.metric.WithLabelValues(verb, u.Host).Observe(latency.Seconds())
+}
+
+type resultAdapter struct {
+	metric *prometheus.CounterVec
+}
+
+func (r resultAdapter) Increment(_ context.Context, code, method, host string) {
+	r.metric.WithLabelValues(code, method, host).Inc()
+}
@@ -0,0 +1,96 @@
+package metrics
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "controller"
+
+var (
+	registry = prometheus.NewRegistry()
+
+	handlerCalls = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "handler",
+		Name:      "calls_total",
+		Help:      "Total number of handler calls by controller, operation and result.",
+	}, []string{"controller", "operation", "result"})
+
+	handlerDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Subsystem: "handler",
+		Name:      "duration_seconds",
+		Help:      "How long in seconds handler calls take by controller and operation.",
+		Buckets:   prometheus.ExponentialBuckets(0.001, 2, 16),
+	}, []string{"controller", "operation"})
+
+	handlerErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "handler",
+		Name:      "errors_total",
+		Help:      "Total number of failed items by controller and error class (permanent, transient, rate_limited).",
+	}, []string{"controller", "class"})
+
+	handlerPanics = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "handler",
+		Name:      "panics_total",
+		Help:      "Total number of recovered panics while processing items by controller.",
+	}, []string{"controller"})
+
+	handlerTimeouts = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Subsystem: "handler",
+		Name:      "timeouts_total",
+		Help:      "Total number of items abandoned because processing exceeded item timeout by controller.",
+	}, []string{"controller"})
+)
+
+func init() {
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		handlerCalls,
+		handlerDuration,
+		handlerErrors,
+		handlerPanics,
+		handlerTimeouts,
+	)
+	registerWorkqueueMetrics()
+	registerClientMetrics()
+}
+
+// Handler returns http handler that exposes all registered metrics
+func Handler() http.Handler {
+	return promhttp.HandlerFor(registry, promhttp.HandlerOpts{})
+}
+
+// ObserveHandlerCall records result and duration of a handler call, started at start time
+func ObserveHandlerCall(controller, operation string, start time.Time, err error) {
+	result := "success"
+	if err != nil {
+		result = "error"
+	}
+	handlerCalls.WithLabelValues(controller, operation, result).Inc()
+	handlerDuration.WithLabelValues(controller, operation).Observe(time.Since(start).Seconds())
+}
+
+// ObserveHandlerError counts failed item by error class
+func ObserveHandlerError(controller, class string) {
+	handlerErrors.WithLabelValues(controller, class).Inc()
+}
+
+// ObserveHandlerPanic counts recovered panic
+func ObserveHandlerPanic(controller string) {
+	handlerPanics.WithLabelValues(controller).Inc()
+}
+
+// ObserveHandlerTimeout counts item abandoned after item timeout
+func ObserveHandlerTimeout(controller string) {
+	handlerTimeouts.WithLabelValues(controller).Inc()
+}
@@ -0,0 +1,54 @@
+package pkg
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+const serverShutdownTimeout = 5 * time.Second
+
+type Server struct {
+	logger *slog.Logger
+	mux    *http.ServeMux
+	server *http.Server
+}
+
+func NewServer(logger *slog.Logger, addr string) *Server {
+	mux := http.NewServeMux()
+	return &Server{
+		logger: logger.With("component", "server"),
+		mux:    mux,
+		server: &http.Server{
+			Addr:              addr,
+			Handler:           mux,
+			ReadHeaderTimeout: 10 * time.Second,
+		},
+	}
+}
+
+func (s *Server) Handle(pattern string, handler http.Handler) {
+	s.mux.Handle(pattern, handler)
+}
+
+// Run starts http server in the background, server is shut down when stop channel is closed
+func (s *Server) Run(stopCh <-chan struct{}) {
+	go func() {
+		s.logger.Info(fmt.Sprintf("starting http server on %s", s.server.Addr))
+		if err := s.server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			s.logger.Error(fmt.Sprintf("http server: %v", err))
+		}
+	}()
+	go func() {
+		<-stopCh
+		ctx, cancel := context.WithTimeout(context.Background(), serverShutdownTimeout)
+		defer cancel()
+		if err := s.server.Shutdown(ctx); err != nil {
+			s.logger.Error(fmt.Sprintf("http server shutdown: %v", err))
+		}
+		s.logger.Info("http server stopped")
+	}()
+}